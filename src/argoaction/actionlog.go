@@ -0,0 +1,39 @@
+package argoaction
+
+import (
+	"github.com/ironashram/argocd-apps-action/internal"
+)
+
+type actionLog struct {
+	internal.ActionInterface
+	entries []logEntry
+}
+
+type logEntry struct {
+	info   bool
+	format string
+	args   []any
+}
+
+func newActionLog(action internal.ActionInterface) *actionLog {
+	return &actionLog{ActionInterface: action}
+}
+
+func (l *actionLog) Debugf(format string, args ...any) {
+	l.entries = append(l.entries, logEntry{format: format, args: args})
+}
+
+func (l *actionLog) Infof(format string, args ...any) {
+	l.entries = append(l.entries, logEntry{info: true, format: format, args: args})
+}
+
+func (l *actionLog) replay() {
+	for _, e := range l.entries {
+		if e.info {
+			l.ActionInterface.Infof(e.format, e.args...)
+		} else {
+			l.ActionInterface.Debugf(e.format, e.args...)
+		}
+	}
+	l.entries = nil
+}
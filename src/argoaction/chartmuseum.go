@@ -0,0 +1,158 @@
+package argoaction
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/ironashram/argocd-apps-action/utils"
+)
+
+type chartMuseumSource struct {
+	index indexSource
+}
+
+func (s *chartMuseumSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	url, err := chartMuseumURL(ref.RepoURL, ref.Chart)
+	if err != nil {
+		return nil, err
+	}
+	index, err := s.index.u.indexes.get(url, ref.Chart, func(map[string]bool) (*models.Index, error) {
+		versions, err := s.fetchChart(ctx, url, ref)
+		if err != nil {
+			return nil, err
+		}
+		return &models.Index{Entries: map[string][]models.ChartVersion{ref.Chart: versions}}, nil
+	})
+	if err == nil {
+		return index.Entries[ref.Chart], nil
+	}
+	if !s.apiDisabled(ctx, ref, err) {
+		return nil, fmt.Errorf("ChartMuseum API for %s: %w", ref.Chart, err)
+	}
+	s.index.action.Debugf("ChartMuseum API disabled for %s, falling back to index.yaml: %v", ref.RepoURL, err)
+	return s.index.ListVersions(ctx, ref)
+}
+
+func (s *chartMuseumSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	versions, err := s.ListVersions(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return findVersion(versions, version, ref.RepoURL)
+}
+
+func (s *chartMuseumSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	return s.index.Verify(ctx, ref, version)
+}
+
+func (s *chartMuseumSource) options(ref models.ChartRef, maxBytes int64) (string, string, []utils.RequestOption, error) {
+	u := s.index.u
+	rt, err := u.transportFor(ref.RepoURL)
+	if err != nil {
+		return "", "", nil, err
+	}
+	username, password, opts := credOptions(u.httpCredential(ref.RepoURL, s.index.action), []utils.RequestOption{
+		utils.WithTransport(rt),
+		utils.WithMaxBytes(maxBytes),
+		utils.WithRetries(u.Config.HTTPRetries),
+		utils.WithTimeout(u.Config.HTTPTimeout),
+	})
+	return username, password, opts, nil
+}
+
+func (s *chartMuseumSource) fetchChart(ctx context.Context, url string, ref models.ChartRef) ([]models.ChartVersion, error) {
+	username, password, opts, err := s.options(ref, s.index.u.maxIndexBytes())
+	if err != nil {
+		return nil, err
+	}
+	body, err := utils.GetHTTPResponse(ctx, url, username, password, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.ChartVersion
+	if err := json.Unmarshal(body, &versions); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", url, err)
+	}
+	return versions, nil
+}
+
+// A 404 of the chart alone means the chart is missing, not that the API is disabled.
+func (s *chartMuseumSource) apiDisabled(ctx context.Context, ref models.ChartRef, err error) bool {
+	var statusErr *utils.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		root, err := chartMuseumURL(ref.RepoURL, "")
+		if err != nil {
+			return false
+		}
+		served, known := s.index.u.museums.probe(strings.TrimSuffix(root, "/"), func() (bool, bool) {
+			return s.probeAPI(ctx, ref, strings.TrimSuffix(root, "/"))
+		})
+		return known && !served
+	default:
+		return false
+	}
+}
+
+func (s *chartMuseumSource) probeAPI(ctx context.Context, ref models.ChartRef, root string) (bool, bool) {
+	username, password, opts, err := s.options(ref, 0)
+	if err != nil {
+		return false, false
+	}
+	body, err := utils.OpenHTTPResponse(ctx, root, username, password, opts...)
+	if err == nil {
+		body.Close()
+		return true, true
+	}
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			return false, true
+		}
+	}
+	return false, false
+}
+
+type museumProbes struct {
+	mu     sync.Mutex
+	served map[string]bool
+}
+
+func (p *museumProbes) probe(root string, fetch func() (served bool, known bool)) (bool, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if served, ok := p.served[root]; ok {
+		return served, true
+	}
+	served, known := fetch()
+	if known {
+		if p.served == nil {
+			p.served = map[string]bool{}
+		}
+		p.served[root] = served
+	}
+	return served, known
+}
+
+func chartMuseumURL(repoURL string, chart string) (string, error) {
+	u, err := neturl.Parse(strings.TrimSuffix(repoURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/api" + u.Path + "/charts/" + chart
+	u.RawPath = ""
+	return u.String(), nil
+}
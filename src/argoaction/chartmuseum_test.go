@@ -0,0 +1,94 @@
+package argoaction
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestChartMuseumURL(t *testing.T) {
+	url, err := chartMuseumURL("https://cm.local/", "app")
+	require.NoError(t, err)
+	assert.Equal(t, "https://cm.local/api/charts/app", url)
+
+	url, err = chartMuseumURL("https://cm.local/org/repo", "app")
+	require.NoError(t, err)
+	assert.Equal(t, "https://cm.local/api/org/repo/charts/app", url)
+}
+
+func TestChartMuseumSource(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://cm.local/api/org/charts/app", func(req *http.Request) (*http.Response, error) {
+		user, pass, ok := req.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "u:p", user+":"+pass)
+		return httpmock.NewStringResponse(200, `[{"name":"app","version":"1.1.0","appVersion":"2.0","urls":["charts/app-1.1.0.tgz"]},{"name":"app","version":"1.0.0"}]`), nil
+	})
+	httpmock.RegisterResponder("GET", "https://cm.local/api/org/charts/other", httpmock.NewStringResponder(404, `{"error":"not found"}`))
+	httpmock.RegisterResponder("GET", "https://cm.local/org/index.yaml",
+		httpmock.NewStringResponder(200, "entries:\n  other: [{version: 3.0.0}]\n"))
+
+	u := &Updater{Config: &models.Config{
+		RepoCreds:   []models.RepoCredential{{URLPrefix: "https://cm.local", Username: "u", Password: "p"}},
+		RepoSources: []models.RepoSource{{URLPrefix: "https://cm.local", Source: "chartmuseum"}},
+	}, Action: mockAction}
+
+	ref := models.ChartRef{RepoURL: "https://cm.local/org", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{
+		{Version: "1.1.0", AppVersion: "2.0", URLs: []string{"charts/app-1.1.0.tgz"}},
+		{Version: "1.0.0"},
+	}, versions)
+	meta, err := src.Metadata(context.Background(), ref, "1.1.0")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0", meta.AppVersion)
+	assert.Zero(t, httpmock.GetCallCountInfo()["GET https://cm.local/org/index.yaml"])
+
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET https://cm.local/api/org/charts/app"], "the chart response is kept")
+
+	// A chart missing from a repository serving the API is an error.
+	httpmock.RegisterResponder("GET", "https://cm.local/api/org/charts", httpmock.NewStringResponder(200, `{}`))
+	ref.Chart = "other"
+	_, err = src.ListVersions(context.Background(), ref)
+	assert.ErrorContains(t, err, "status code 404")
+	assert.Zero(t, httpmock.GetCallCountInfo()["GET https://cm.local/org/index.yaml"])
+}
+
+func TestChartMuseumSource_Fallback(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://plain.local/api/charts/app", httpmock.NewStringResponder(404, ""))
+	httpmock.RegisterResponder("GET", "https://plain.local/api/charts", httpmock.NewStringResponder(404, ""))
+	httpmock.RegisterResponder("GET", "https://plain.local/index.yaml", httpmock.NewStringResponder(200, "entries:\n  app: [{version: 3.0.0}]\n"))
+	httpmock.RegisterResponder("GET", "https://private.local/api/charts/app", httpmock.NewStringResponder(401, ""))
+	httpmock.RegisterResponder("GET", "https://private.local/index.yaml", httpmock.NewStringResponder(200, "entries:\n  app: [{version: 3.0.0}]\n"))
+
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	src := &chartMuseumSource{index: indexSource{u: u, action: mockAction}}
+
+	versions, err := src.ListVersions(context.Background(), models.ChartRef{RepoURL: "https://plain.local", Chart: "app"})
+	require.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "3.0.0"}}, versions)
+
+	_, err = src.ListVersions(context.Background(), models.ChartRef{RepoURL: "https://private.local", Chart: "app"})
+	assert.ErrorContains(t, err, "status code 401")
+	assert.Zero(t, httpmock.GetCallCountInfo()["GET https://private.local/index.yaml"])
+}
@@ -0,0 +1,160 @@
+package argoaction
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ironashram/argocd-apps-action/cloudauth"
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/ironashram/argocd-apps-action/utils"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+)
+
+type credentialStores struct {
+	cloudOnce  sync.Once
+	cloud      *cloudauth.Resolver
+	dockerOnce sync.Once
+	docker     credentials.Store
+	netrcOnce  sync.Once
+	netrc      []netrcEntry
+	objectsMu  sync.Mutex
+	objects    map[string]objectStore
+}
+
+func (u *Updater) httpCredential(repoURL string, action internal.ActionInterface) *models.RepoCredential {
+	if cred := credFor(u.Config.RepoCreds, repoURL); cred != nil {
+		return cred
+	}
+	u.stores.netrcOnce.Do(func() {
+		u.stores.netrc = loadNetrc(action, u.fileSystem())
+	})
+	return netrcCredential(u.stores.netrc, repoURL)
+}
+
+func (u *Updater) ociCredential(repoURL string, action internal.ActionInterface) (*models.RepoCredential, auth.CredentialFunc) {
+	if cred := credFor(u.Config.RepoCreds, repoURL); cred != nil {
+		return cred, nil
+	}
+	u.stores.cloudOnce.Do(func() {
+		u.stores.cloud = cloudauth.NewResolver(utils.NewHTTPClient(u.Config.HTTPRetries, u.Config.HTTPTimeout, nil), action.Getenv)
+	})
+	host, _, _ := strings.Cut(stripScheme(repoURL), "/")
+	if p, credential := u.stores.cloud.For(host); credential != nil {
+		action.Debugf("Using %s credentials from the environment for %s", p.Name(), host)
+		return nil, credential
+	}
+	u.stores.dockerOnce.Do(func() {
+		store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+		if err != nil {
+			action.Debugf("Ignoring docker credentials: %v", err)
+			return
+		}
+		u.stores.docker = store
+	})
+	if u.stores.docker == nil {
+		return nil, nil
+	}
+	return nil, credentials.Credential(u.stores.docker)
+}
+
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+func netrcPath(action internal.ActionInterface) string {
+	if p := action.Getenv("NETRC"); p != "" {
+		return p
+	}
+	if home := action.Getenv("HOME"); home != "" {
+		return filepath.Join(home, ".netrc")
+	}
+	return ""
+}
+
+func loadNetrc(action internal.ActionInterface, osi internal.OSInterface) []netrcEntry {
+	p := netrcPath(action)
+	if p == "" {
+		return nil
+	}
+	data, err := osi.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			action.Debugf("Ignoring %s: %v", p, err)
+		}
+		return nil
+	}
+	return parseNetrc(string(data))
+}
+
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	var cur *netrcEntry
+	inMacro := false
+
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		line := sc.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			next := func() string {
+				if i+1 < len(fields) {
+					i++
+					return fields[i]
+				}
+				return ""
+			}
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				cur = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				cur = &entries[len(entries)-1]
+			case "login":
+				if v := next(); cur != nil {
+					cur.login = v
+				}
+			case "password":
+				if v := next(); cur != nil {
+					cur.password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	return entries
+}
+
+// The default entry is never used: it would send the runner's login to any host.
+func netrcCredential(entries []netrcEntry, repoURL string) *models.RepoCredential {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	for _, e := range entries {
+		if e.machine != "" && (strings.EqualFold(e.machine, u.Host) || strings.EqualFold(e.machine, u.Hostname())) {
+			return &models.RepoCredential{URLPrefix: u.Host, Username: e.login, Password: e.password}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package argoaction
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestNetrcCredential(t *testing.T) {
+	entries := parseNetrc(`# comment
+machine charts.example.com login alice password s3cret
+machine other.example.com:8443
+  login bob
+  password hunter2
+macdef init
+machine evil.example.com login mallory password nope
+
+default login anon password guest
+`)
+
+	testCases := []struct {
+		name     string
+		url      string
+		expected *models.RepoCredential
+	}{
+		{name: "machine", url: "https://charts.example.com/stable", expected: &models.RepoCredential{URLPrefix: "charts.example.com", Username: "alice", Password: "s3cret"}},
+		{name: "machine with port", url: "https://other.example.com:8443", expected: &models.RepoCredential{URLPrefix: "other.example.com:8443", Username: "bob", Password: "hunter2"}},
+		{name: "macro body is skipped", url: "https://evil.example.com"},
+		{name: "default entry is not used", url: "https://third-party.example.org"},
+		{name: "not a URL", url: "registry.local/charts"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, netrcCredential(entries, tc.url))
+		})
+	}
+}
+
+func TestLoadNetrc(t *testing.T) {
+	mockOS := new(mocks.MockOS)
+	mockOS.On("ReadFile", "/home/runner/.netrc").Return([]byte("machine charts.local login home password pass\n"), nil)
+	mockOS.On("ReadFile", "/run/secrets/netrc").Return([]byte("machine charts.local login secret password pass\n"), nil)
+	mockOS.On("ReadFile", "/nonexistent/.netrc").Return([]byte(nil), os.ErrNotExist)
+	mockAction := &mocks.MockActionInterface{Env: map[string]string{"HOME": "/home/runner"}}
+
+	assert.Equal(t, []netrcEntry{{machine: "charts.local", login: "home", password: "pass"}}, loadNetrc(mockAction, mockOS))
+
+	mockAction.Env["NETRC"] = "/run/secrets/netrc"
+	assert.Equal(t, []netrcEntry{{machine: "charts.local", login: "secret", password: "pass"}}, loadNetrc(mockAction, mockOS))
+
+	mockAction.Env = map[string]string{"HOME": "/nonexistent"}
+	assert.Empty(t, loadNetrc(mockAction, mockOS))
+
+	mockAction.Env = map[string]string{}
+	assert.Empty(t, loadNetrc(mockAction, mockOS))
+	mockOS.AssertExpectations(t)
+}
+
+func TestCredentialFallbacks(t *testing.T) {
+	dir := t.TempDir()
+	encoded := base64.StdEncoding.EncodeToString([]byte("docker:pass"))
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"auths":{"registry.local":{"auth":"`+encoded+`"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	netrc := filepath.Join(dir, "netrc")
+	if err := os.WriteFile(netrc, []byte("machine charts.local login netrc password pass\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}, Env: map[string]string{"NETRC": netrc}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	basic := func(user string, body string) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			if u, p, ok := req.BasicAuth(); !ok || u != user || p != "pass" {
+				resp := httpmock.NewStringResponse(401, "")
+				resp.Header.Set("WWW-Authenticate", `Basic realm="test"`)
+				return resp, nil
+			}
+			return httpmock.NewStringResponse(200, body), nil
+		}
+	}
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/app/tags/list", basic("docker", `{"tags":["1.0.0"]}`))
+	httpmock.RegisterResponder("GET", "https://charts.local/index.yaml", basic("netrc", "entries:\n  app:\n  - version: 2.0.0\n"))
+	httpmock.RegisterResponder("GET", "https://explicit.local/index.yaml", basic("explicit", "entries:\n  app:\n  - version: 3.0.0\n"))
+
+	u := &Updater{Config: &models.Config{
+		RepoCreds: []models.RepoCredential{{URLPrefix: "https://explicit.local", Username: "explicit", Password: "pass"}},
+	}}
+
+	versions, err := (&ociSource{u: u, action: mockAction}).ListVersions(context.Background(), models.ChartRef{RepoURL: "oci://registry.local/charts", Chart: "app"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "1.0.0"}}, versions)
+
+	versions, err = (&indexSource{u: u, action: mockAction}).ListVersions(context.Background(), models.ChartRef{RepoURL: "https://charts.local", Chart: "app"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "2.0.0"}}, versions)
+
+	versions, err = (&indexSource{u: u, action: mockAction}).ListVersions(context.Background(), models.ChartRef{RepoURL: "https://explicit.local", Chart: "app"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "3.0.0"}}, versions)
+}
@@ -8,9 +8,10 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"text/template"
 
-	"github.com/Masterminds/semver/v3"
 	"github.com/ironashram/argocd-apps-action/internal"
 	"github.com/ironashram/argocd-apps-action/models"
 
@@ -19,14 +20,15 @@ import (
 
 var multiSourceRe = regexp.MustCompile(`(?m)^\s+sources:\s*$`)
 
-func argocdPreset(regexFallback bool) *models.SourcesConfig {
+func argocdPreset(regexFallback, valuesTemplates bool) *models.SourcesConfig {
 	return &models.SourcesConfig{
 		Charts: []models.ChartRule{{
-			Files:         []string{"*"},
-			ChartPath:     "spec.source.chart",
-			VersionPath:   "spec.source.targetRevision",
-			URLPath:       "spec.source.repoURL",
-			RegexFallback: regexFallback,
+			Files:           []string{"*"},
+			ChartPath:       "spec.source.chart",
+			VersionPath:     "spec.source.targetRevision",
+			URLPath:         "spec.source.repoURL",
+			RegexFallback:   regexFallback,
+			ValuesTemplates: valuesTemplates,
 		}},
 	}
 }
@@ -60,6 +62,11 @@ func fluxPreset() *models.SourcesConfig {
 }
 
 func SourcesFor(cfg *models.Config, osi internal.OSInterface) (*models.SourcesConfig, error) {
+	for _, rs := range cfg.RepoSources {
+		if _, ok := versionSources[rs.Source]; !ok {
+			return nil, fmt.Errorf("unknown source %q in repo_sources for %s, expected one of %s", rs.Source, rs.URLPrefix, strings.Join(sourceNames(), ", "))
+		}
+	}
 	if cfg.SourcesFile != "" {
 		data, err := osi.ReadFile(filepath.Join(cfg.Workspace, cfg.SourcesFile))
 		if err != nil {
@@ -69,13 +76,18 @@ func SourcesFor(cfg *models.Config, osi internal.OSInterface) (*models.SourcesCo
 		if err := yaml.Unmarshal(data, &sc); err != nil {
 			return nil, err
 		}
+		for _, c := range sc.Charts {
+			if _, ok := versionSources[c.Source]; c.Source != "" && !ok {
+				return nil, fmt.Errorf("unknown source %q, expected one of %s", c.Source, strings.Join(sourceNames(), ", "))
+			}
+		}
 		return &sc, nil
 	}
 	switch strings.ToLower(strings.TrimSpace(cfg.Preset)) {
 	case "flux":
 		return fluxPreset(), nil
 	case "argocd", "":
-		return argocdPreset(cfg.AllowRegexFallback), nil
+		return argocdPreset(cfg.AllowRegexFallback, cfg.ValuesTemplates), nil
 	default:
 		return nil, fmt.Errorf("unknown preset: %s", cfg.Preset)
 	}
@@ -91,7 +103,7 @@ type parsedFile struct {
 func (u *Updater) collectCandidates(dir string, osw internal.OSInterface) (map[models.ChartRef][]models.AppFile, []error) {
 	sc := u.Sources
 	if sc == nil {
-		sc = argocdPreset(u.Config.AllowRegexFallback)
+		sc = argocdPreset(u.Config.AllowRegexFallback, u.Config.ValuesTemplates)
 	}
 
 	candidates := map[models.ChartRef][]models.AppFile{}
@@ -116,7 +128,7 @@ func (u *Updater) collectCandidates(dir string, osw internal.OSInterface) (map[m
 			errs = append(errs, rerr)
 			return nil
 		}
-		docs, derr := decodeDocs(data)
+		docs, derr := decodeFile(p, data)
 		files = append(files, parsedFile{path: p, raw: data, docs: docs, decErr: derr})
 		return nil
 	})
@@ -151,19 +163,34 @@ func (u *Updater) collectCandidates(dir string, osw internal.OSInterface) (map[m
 	for _, f := range files {
 		matched := false
 
+		for _, c := range sc.Charts {
+			if !c.ValuesTemplates || !matchFiles(c.Files, f.path) || !valuesRefRe.Match(f.raw) {
+				continue
+			}
+			for _, vc := range valuesExtract(f, c, index, osw, u.Action) {
+				if !slices.ContainsFunc(candidates[vc.ref], sameField(vc.file)) {
+					candidates[vc.ref] = append(candidates[vc.ref], vc.file)
+				}
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+
 		if f.decErr != nil {
 			for _, c := range sc.Charts {
 				if !matchFiles(c.Files, f.path) || !c.RegexFallback {
 					continue
 				}
 				ref, af, ok := regexExtract(f.raw, c, u.Action, f.path)
-				if ok {
+				if ok && applyVersionPattern(&af, c, u.Action) {
 					candidates[ref] = append(candidates[ref], af)
 					matched = true
 				}
 			}
 			if !matched {
-				u.Action.Debugf("Error reading and parsing YAML %s: %v", f.path, f.decErr)
+				u.Action.Debugf("Error reading and parsing %s: %v", f.path, f.decErr)
 				errs = append(errs, f.decErr)
 			}
 			continue
@@ -178,12 +205,20 @@ func (u *Updater) collectCandidates(dir string, osw internal.OSInterface) (map[m
 				if !ok {
 					continue
 				}
-				candidates[ref] = append(candidates[ref], models.AppFile{
+				af := models.AppFile{
 					Path:           f.path,
 					CurrentVersion: ver,
 					VersionPath:    c.VersionPath,
 					DocIndex:       di,
-				})
+					LinkedFields:   c.LinkedFields,
+				}
+				if !applyVersionPattern(&af, c, u.Action) {
+					continue
+				}
+				if !isJSON(f.path) {
+					af.Dependents = anchorDependents(f.raw, di, c.VersionPath)
+				}
+				candidates[ref] = append(candidates[ref], af)
 				matched = true
 			}
 		}
@@ -240,7 +275,7 @@ func extractChart(doc map[string]any, c models.ChartRule, index map[string]strin
 		return models.ChartRef{}, "", false
 	}
 
-	return models.ChartRef{RepoURL: repoURL, Chart: chart}, version, true
+	return models.ChartRef{RepoURL: repoURL, Chart: chart, Source: c.Source}, version, true
 }
 
 func regexExtract(data []byte, c models.ChartRule, action internal.ActionInterface, p string) (models.ChartRef, models.AppFile, bool) {
@@ -250,23 +285,69 @@ func regexExtract(data []byte, c models.ChartRule, action internal.ActionInterfa
 	if multiSourceRe.Match(data) {
 		action.Infof("File %s contains a multi-source spec; regex fallback will only extract the first source", p)
 	}
-	chart := reField(data, leafKey(c.ChartPath))
-	url := reField(data, leafKey(c.URLPath))
-	ver := reField(data, leafKey(c.VersionPath))
+	chart, _ := reField(data, leafKey(c.ChartPath))
+	url, _ := reField(data, leafKey(c.URLPath))
+	ver, off := reField(data, leafKey(c.VersionPath))
 	if chart == "" || url == "" || ver == "" {
 		return models.ChartRef{}, models.AppFile{}, false
 	}
-	return models.ChartRef{RepoURL: stripOCI(url), Chart: chart},
-		models.AppFile{Path: p, CurrentVersion: ver, VersionPath: c.VersionPath},
+	return models.ChartRef{RepoURL: stripOCI(url), Chart: chart, Source: c.Source},
+		models.AppFile{Path: p, CurrentVersion: ver, VersionPath: c.VersionPath, Offset: off},
 		true
 }
 
-func reField(data []byte, leaf string) string {
-	re := regexp.MustCompile(`(?m)^\s+` + regexp.QuoteMeta(leaf) + `:\s*(\S.*?)\s*$`)
-	if m := re.FindSubmatch(data); len(m) == 2 {
-		return strings.Trim(string(m[1]), `"'`)
+func applyVersionPattern(af *models.AppFile, c models.ChartRule, action internal.ActionInterface) bool {
+	if c.VersionPattern == "" {
+		return true
+	}
+	re, err := regexp.Compile(c.VersionPattern)
+	if err != nil {
+		action.Infof("Invalid versionPattern %q: %v", c.VersionPattern, err)
+		return false
+	}
+	start, end, ok := versionSpan(re, af.CurrentVersion)
+	if !ok {
+		action.Debugf("Version %q in %s does not match versionPattern %q", af.CurrentVersion, af.Path, c.VersionPattern)
+		return false
 	}
-	return ""
+	af.RawVersion = af.CurrentVersion
+	af.CurrentVersion = af.RawVersion[start:end]
+	af.VersionPattern = c.VersionPattern
+	af.VersionTemplate = c.VersionTemplate
+	return true
+}
+
+func versionSpan(re *regexp.Regexp, s string) (int, int, bool) {
+	m := re.FindStringSubmatchIndex(s)
+	if m == nil {
+		return 0, 0, false
+	}
+	group := 0
+	if i := re.SubexpIndex("version"); i > 0 {
+		group = i
+	} else if re.NumSubexp() > 0 {
+		group = 1
+	}
+	if m[2*group] < 0 {
+		return 0, 0, false
+	}
+	return m[2*group], m[2*group+1], true
+}
+
+func reField(data []byte, leaf string) (string, int) {
+	re := regexp.MustCompile(`(?m)^\s+` + regexp.QuoteMeta(leaf) + `:\s*(\S.*?)\s*(?:\s#.*)?$`)
+	m := re.FindSubmatchIndex(data)
+	if len(m) != 4 {
+		return "", 0
+	}
+	start, end := m[2], m[3]
+	for start < end && (data[start] == '"' || data[start] == '\'') {
+		start++
+	}
+	for end > start && (data[end-1] == '"' || data[end-1] == '\'') {
+		end--
+	}
+	return string(data[start:end]), start
 }
 
 func decodeDocs(data []byte) ([]map[string]any, error) {
@@ -305,15 +386,8 @@ func matchFiles(patterns []string, p string) bool {
 }
 
 func getPath(m map[string]any, p string) any {
-	cur := any(m)
-	for _, part := range strings.Split(p, ".") {
-		mm, ok := cur.(map[string]any)
-		if !ok {
-			return nil
-		}
-		cur = mm[part]
-	}
-	return cur
+	v, _ := lookupPath(m, p)
+	return v
 }
 
 func getString(m map[string]any, p string) string {
@@ -336,23 +410,37 @@ func hasPath(m map[string]any, p string) bool {
 	if p == "" {
 		return false
 	}
+	_, ok := lookupPath(m, p)
+	return ok
+}
+
+func lookupPath(m map[string]any, p string) (any, bool) {
 	cur := any(m)
-	parts := strings.Split(p, ".")
-	for i, part := range parts {
-		mm, ok := cur.(map[string]any)
-		if !ok {
-			return false
-		}
-		v, ok := mm[part]
-		if !ok {
-			return false
+	for i, layer := range strings.Split(p, "|") {
+		if i > 0 {
+			s, ok := cur.(string)
+			if !ok {
+				return nil, false
+			}
+			var inner map[string]any
+			if err := yaml.Unmarshal([]byte(s), &inner); err != nil {
+				return nil, false
+			}
+			cur = inner
 		}
-		if i == len(parts)-1 {
-			return true
+		for _, part := range splitPath(layer) {
+			mm, ok := cur.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			v, ok := mm[part]
+			if !ok {
+				return nil, false
+			}
+			cur = v
 		}
-		cur = v
 	}
-	return true
+	return cur, true
 }
 
 func stripOCI(u string) string {
@@ -360,99 +448,159 @@ func stripOCI(u string) string {
 }
 
 func leafKey(p string) string {
-	if i := strings.LastIndex(p, "."); i >= 0 {
-		return p[i+1:]
+	parts := splitPath(p)
+	return parts[len(parts)-1]
+}
+
+func splitPath(p string) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(p); i++ {
+		switch {
+		case p[i] == '\\' && i+1 < len(p) && p[i+1] == '.':
+			cur.WriteByte('.')
+			i++
+		case p[i] == '.':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(p[i])
+		}
 	}
-	return p
+	return append(parts, cur.String())
 }
 
-func (u *Updater) updateVersion(f models.AppFile, newest *semver.Version, osw internal.OSInterface) error {
+func (u *Updater) updateVersion(f models.AppFile, b bump, osw internal.OSInterface) error {
 	data, err := osw.ReadFile(f.Path)
 	if err != nil {
 		u.Action.Debugf("Error reading file: %v", err)
 		return err
 	}
-	out := writeVersion(data, f, newest.String())
+	value, err := formatVersion(f, b)
+	if err != nil {
+		return err
+	}
+	out, err := writeVersion(data, f, value)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", f.VersionPath, err)
+	}
+	out, err = writeLinkedFields(out, f, b)
+	if err != nil {
+		return err
+	}
 	if err := osw.WriteFile(f.Path, out, 0644); err != nil {
 		u.Action.Debugf("Error writing file: %v", err)
 		return err
 	}
+
+	written, err := osw.ReadFile(f.Path)
+	if err == nil {
+		err = verifyRewrite(data, written, f)
+	}
+	if err != nil {
+		u.Action.Infof("Rewrite of %s did not only change %s, restoring it: %v", f.Path, f.VersionPath, err)
+		if rerr := osw.WriteFile(f.Path, data, 0644); rerr != nil {
+			return fmt.Errorf("restoring %s: %w", f.Path, rerr)
+		}
+		return fmt.Errorf("verifying rewrite: %w", err)
+	}
 	return nil
 }
 
-func writeVersion(data []byte, f models.AppFile, newest string) []byte {
-	if out, ok := replaceVersionAtPath(data, f.DocIndex, f.VersionPath, f.CurrentVersion, newest); ok {
-		return out
+func formatVersion(f models.AppFile, b bump) (string, error) {
+	if f.VersionTemplate != "" {
+		return renderTemplate("versionTemplate", f.VersionTemplate, b)
 	}
-	return leafLineReplace(data, leafKey(f.VersionPath), newest)
+	newest := styleVersion(f.CurrentVersion, b.published())
+	if f.VersionPattern == "" {
+		return newest, nil
+	}
+	re, err := regexp.Compile(f.VersionPattern)
+	if err != nil {
+		return "", err
+	}
+	start, end, ok := versionSpan(re, f.RawVersion)
+	if !ok {
+		return "", fmt.Errorf("version %q does not match versionPattern %q", f.RawVersion, f.VersionPattern)
+	}
+	return f.RawVersion[:start] + newest + f.RawVersion[end:], nil
 }
 
-func replaceVersionAtPath(data []byte, docIndex int, p, oldValue, newest string) ([]byte, bool) {
-	if oldValue == "" {
-		return nil, false
+// The published string is kept as is so that OCI tags still resolve.
+func styleVersion(current, published string) string {
+	if strings.HasPrefix(current, "v") && !strings.HasPrefix(published, "v") {
+		return "v" + published
 	}
-	dec := yaml.NewDecoder(bytes.NewReader(data))
-	idx := 0
-	for {
-		var node yaml.Node
-		if err := dec.Decode(&node); err != nil {
-			return nil, false
-		}
-		if idx == docIndex {
-			target := nodeAtPath(&node, strings.Split(p, "."))
-			if target == nil || target.Kind != yaml.ScalarNode {
-				return nil, false
-			}
-			lineIdx := target.Line - 1
-			lines := strings.Split(string(data), "\n")
-			if lineIdx < 0 || lineIdx >= len(lines) {
-				return nil, false
-			}
-			if !strings.Contains(lines[lineIdx], oldValue) {
-				return nil, false
-			}
-			lines[lineIdx] = strings.Replace(lines[lineIdx], oldValue, newest, 1)
-			return []byte(strings.Join(lines, "\n")), true
-		}
-		idx++
+	return published
+}
+
+func rawVersion(f models.AppFile) string {
+	if f.RawVersion != "" {
+		return f.RawVersion
 	}
+	return f.CurrentVersion
 }
 
-func nodeAtPath(n *yaml.Node, parts []string) *yaml.Node {
-	if n.Kind == yaml.DocumentNode {
-		if len(n.Content) == 0 {
-			return nil
-		}
-		n = n.Content[0]
+func writeLinkedFields(data []byte, f models.AppFile, b bump) ([]byte, error) {
+	if len(f.LinkedFields) == 0 {
+		return data, nil
 	}
-	cur := n
-	for _, part := range parts {
-		if cur.Kind != yaml.MappingNode {
-			return nil
+	docs, err := decodeFile(f.Path, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode document %d for linked fields: %w", f.DocIndex, err)
+	}
+	if f.DocIndex >= len(docs) {
+		return nil, fmt.Errorf("document index %d out of range for linked fields, %s has %d documents", f.DocIndex, f.Path, len(docs))
+	}
+	for _, lf := range f.LinkedFields {
+		value, err := renderLinked(lf, b)
+		if err != nil {
+			return nil, err
 		}
-		var next *yaml.Node
-		for i := 0; i+1 < len(cur.Content); i += 2 {
-			if cur.Content[i].Value == part {
-				next = cur.Content[i+1]
-				break
-			}
+		current := getString(docs[f.DocIndex], lf.Path)
+		if current == "" {
+			return nil, fmt.Errorf("linked field %s not found", lf.Path)
 		}
-		if next == nil {
-			return nil
+		if current == value {
+			continue
 		}
-		cur = next
+		out, err := replaceValue(f.Path, data, f.DocIndex, lf.Path, current, value)
+		if err != nil {
+			return nil, fmt.Errorf("linked field %s: %w", lf.Path, err)
+		}
+		data = out
 	}
-	return cur
+	return data, nil
 }
 
-func leafLineReplace(data []byte, leaf, newest string) []byte {
-	re := regexp.MustCompile(`(.*` + regexp.QuoteMeta(leaf) + `: ).*`)
-	lines := strings.Split(string(data), "\n")
-	for i, line := range lines {
-		if strings.Contains(line, leaf+":") {
-			lines[i] = re.ReplaceAllString(line, "${1}"+newest)
-			break
-		}
+func renderLinked(lf models.LinkedField, b bump) (string, error) {
+	text := lf.Template
+	if text == "" {
+		text = "{{ .Version }}"
+	}
+	out, err := renderTemplate(lf.Path, text, b)
+	if err != nil {
+		return "", fmt.Errorf("linked field %w", err)
+	}
+	return out, nil
+}
+
+func renderTemplate(name, text string, b bump) (string, error) {
+	if strings.Contains(text, ".AppVersion") && b.AppVersion == "" {
+		return "", fmt.Errorf("%s needs the appVersion of %s %s, which is unknown", name, b.Chart, b.Version)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	var out strings.Builder
+	err = tmpl.Execute(&out, map[string]string{
+		"Chart":      b.Chart,
+		"Version":    b.published(),
+		"AppVersion": b.AppVersion,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
 	}
-	return []byte(strings.Join(lines, "\n"))
+	return out.String(), nil
 }
@@ -2,8 +2,10 @@ package argoaction
 
 import (
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
@@ -131,7 +133,8 @@ spec:
   interval: 5m
 `
 	f := models.AppFile{VersionPath: "spec.chart.spec.version", CurrentVersion: "0.15.2", DocIndex: 0}
-	out := writeVersion([]byte(content), f, "0.16.1")
+	out, err := writeVersion([]byte(content), f, "0.16.1")
+	assert.NoError(t, err)
 	assert.Equal(t, expected, string(out))
 }
 
@@ -149,21 +152,40 @@ func TestWriteVersion_ArgoTargetRevision(t *testing.T) {
     targetRevision: 0.2.0
 `
 	f := models.AppFile{VersionPath: "spec.source.targetRevision", CurrentVersion: "0.1.2", DocIndex: 0}
-	out := writeVersion([]byte(content), f, "0.2.0")
+	out, err := writeVersion([]byte(content), f, "0.2.0")
+	assert.NoError(t, err)
 	assert.Equal(t, expected, string(out))
 }
 
-func TestWriteVersion_LeafFallbackOnTemplated(t *testing.T) {
+func TestWriteVersion_RegexFallbackOffset(t *testing.T) {
 	content := `spec:
   source:
     chart: {{ .Values.chart }}
     repoURL: https://test.local
+    targetRevision: "1.2.3" # pinned
+  other:
     targetRevision: 1.2.3
 `
-	f := models.AppFile{VersionPath: "spec.source.targetRevision", CurrentVersion: "1.2.3", DocIndex: 0}
-	out := writeVersion([]byte(content), f, "1.3.0")
-	assert.Contains(t, string(out), "targetRevision: 1.3.0")
-	assert.NotContains(t, string(out), "targetRevision: 1.2.3")
+	expected := `spec:
+  source:
+    chart: {{ .Values.chart }}
+    repoURL: https://test.local
+    targetRevision: "1.3.0" # pinned
+  other:
+    targetRevision: 1.2.3
+`
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	ref, f, ok := regexExtract([]byte(content), argocdPreset(true, false).Charts[0], mockAction, "a.yaml")
+	assert.True(t, ok)
+	assert.Equal(t, "{{ .Values.chart }}", ref.Chart)
+	assert.Equal(t, "1.2.3", f.CurrentVersion)
+
+	out, err := writeVersion([]byte(content), f, "1.3.0")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+
+	_, err = writeVersion([]byte(strings.Replace(content, "1.2.3", "1.2.4", 1)), f, "1.3.0")
+	assert.Error(t, err)
 }
 
 func TestSourcesFor(t *testing.T) {
@@ -270,3 +292,343 @@ func TestSourcesFor_CustomFile(t *testing.T) {
 	assert.Equal(t, "spec.version", sc.Charts[0].VersionPath)
 	assert.Equal(t, "spec.repo", sc.Charts[0].URLPath)
 }
+
+func TestEmbeddedValuesPath(t *testing.T) {
+	content := `apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: podinfo
+    repoURL: https://stefanprodan.github.io/podinfo
+    targetRevision: 6.5.0
+    helm:
+      values: |
+        replicaCount: 2
+        sidecar:
+          tag: 6.5.0
+        image:
+          repository: ghcr.io/stefanprodan/podinfo
+          tag: 6.5.0
+`
+	expected := `apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: podinfo
+    repoURL: https://stefanprodan.github.io/podinfo
+    targetRevision: 6.5.0
+    helm:
+      values: |
+        replicaCount: 2
+        sidecar:
+          tag: 6.5.0
+        image:
+          repository: ghcr.io/stefanprodan/podinfo
+          tag: 6.6.0
+`
+	docs, err := decodeDocs([]byte(content))
+	assert.NoError(t, err)
+	assert.Equal(t, "6.5.0", getString(docs[0], "spec.source.helm.values|image.tag"))
+	assert.True(t, hasPath(docs[0], "spec.source.helm.values|replicaCount"))
+	assert.False(t, hasPath(docs[0], "spec.source.helm.values|image.digest"))
+	assert.Equal(t, "", getString(docs[0], "spec.source.chart|image.tag"))
+
+	f := models.AppFile{VersionPath: "spec.source.helm.values|image.tag", CurrentVersion: "6.5.0", DocIndex: 0}
+	out, err := writeVersion([]byte(content), f, "6.6.0")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+}
+
+func TestWriteLinkedFields(t *testing.T) {
+	content := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: redis
+  labels:
+    chart-version: 18.1.0
+  annotations:
+    app.kubernetes.io/version: "7.2.1"
+spec:
+  chart:
+    spec:
+      chart: redis
+      version: 18.1.0
+  values:
+    image:
+      tag: 7.2.1-debian-11
+`
+	expected := `apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: redis
+  labels:
+    chart-version: 18.2.0
+  annotations:
+    app.kubernetes.io/version: "7.2.4"
+spec:
+  chart:
+    spec:
+      chart: redis
+      version: 18.1.0
+  values:
+    image:
+      tag: 7.2.4-debian-11
+`
+	f := models.AppFile{
+		VersionPath:    "spec.chart.spec.version",
+		CurrentVersion: "18.1.0",
+		LinkedFields: []models.LinkedField{
+			{Path: "metadata.labels.chart-version"},
+			{Path: `metadata.annotations.app\.kubernetes\.io/version`, Template: "{{ .AppVersion }}"},
+			{Path: "spec.values.image.tag", Template: "{{ .AppVersion }}-debian-11"},
+		},
+	}
+	b := bump{Chart: "redis", Version: semver.MustParse("18.2.0"), AppVersion: "7.2.4"}
+
+	out, err := writeLinkedFields([]byte(content), f, b)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, string(out))
+
+	b.AppVersion = ""
+	_, err = writeLinkedFields([]byte(content), f, b)
+	assert.ErrorContains(t, err, "appVersion of redis 18.2.0")
+
+	f.LinkedFields = []models.LinkedField{{Path: "metadata.labels.missing"}}
+	_, err = writeLinkedFields([]byte(content), f, b)
+	assert.ErrorContains(t, err, "linked field metadata.labels.missing not found")
+
+	f.DocIndex = 1
+	_, err = writeLinkedFields([]byte(content), f, b)
+	assert.ErrorContains(t, err, "document index 1 out of range")
+	assert.NotContains(t, err.Error(), "<nil>")
+}
+
+func TestSplitPath(t *testing.T) {
+	assert.Equal(t, []string{"spec", "source", "targetRevision"}, splitPath("spec.source.targetRevision"))
+	assert.Equal(t, []string{"metadata", "annotations", "app.kubernetes.io/version"}, splitPath(`metadata.annotations.app\.kubernetes\.io/version`))
+	assert.Equal(t, "app.kubernetes.io/version", leafKey(`metadata.annotations.app\.kubernetes\.io/version`))
+}
+
+func TestVersionPattern(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	testCases := []struct {
+		name     string
+		raw      string
+		pattern  string
+		template string
+		current  string
+		written  string
+	}{
+		{
+			name:    "prefixed chart version",
+			raw:     "chart-1.2.3",
+			pattern: `^chart-(\d+\.\d+\.\d+)$`,
+			current: "1.2.3",
+			written: "chart-1.4.0",
+		},
+		{
+			name:     "custom suffix rewritten by template",
+			raw:      "1.2.3-custom.0",
+			pattern:  `^(?P<version>\d+\.\d+\.\d+)-custom\.\d+$`,
+			template: "{{ .Version }}-custom.0",
+			current:  "1.2.3",
+			written:  "1.4.0-custom.0",
+		},
+		{
+			name:    "release path keeps v prefix",
+			raw:     "release/v1.2.3",
+			pattern: `release/(v[0-9.]+)`,
+			current: "v1.2.3",
+			written: "release/v1.4.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			af := models.AppFile{Path: "a.yaml", CurrentVersion: tc.raw, VersionPath: "spec.version"}
+			c := models.ChartRule{VersionPattern: tc.pattern, VersionTemplate: tc.template}
+			assert.True(t, applyVersionPattern(&af, c, mockAction))
+			assert.Equal(t, tc.current, af.CurrentVersion)
+			assert.Equal(t, tc.raw, af.RawVersion)
+
+			written, err := formatVersion(af, bump{Chart: "c", Version: semver.MustParse("1.4.0")})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.written, written)
+
+			out, err := writeVersion([]byte("spec:\n  version: "+tc.raw+"\n"), af, written)
+			assert.NoError(t, err)
+			assert.Equal(t, "spec:\n  version: "+tc.written+"\n", string(out))
+		})
+	}
+
+	af := models.AppFile{Path: "a.yaml", CurrentVersion: "latest"}
+	assert.False(t, applyVersionPattern(&af, models.ChartRule{VersionPattern: `^chart-(\d+\.\d+\.\d+)$`}, mockAction))
+}
+
+func TestFormatVersion_PreservesStyle(t *testing.T) {
+	testCases := []struct {
+		name      string
+		current   string
+		published string
+		tag       string
+		expected  string
+	}{
+		{name: "plain", current: "1.2.3", published: "1.4.0", expected: "1.4.0"},
+		{name: "v prefix kept", current: "v1.2.3", published: "1.4.0", expected: "v1.4.0"},
+		{name: "published v tag kept", current: "1.2.3", published: "v1.4.0", expected: "v1.4.0"},
+		{name: "exact tag not normalized", current: "1.2.3", published: "1.4", expected: "1.4"},
+		{name: "build metadata kept", current: "1.2.3", published: "1.4.0+build.7", expected: "1.4.0+build.7"},
+		{name: "OCI tag kept", current: "1.2.3", published: "1.4.0+build.7", tag: "1.4.0_build.7", expected: "1.4.0_build.7"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := models.AppFile{CurrentVersion: tc.current}
+			written, err := formatVersion(f, bump{Chart: "c", Version: semver.MustParse(tc.published), Tag: tc.tag})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, written)
+		})
+	}
+}
+
+func TestWriteVersion_Styles(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		path     string
+		doc      int
+		old      string
+		expected string
+	}{
+		{
+			name:     "double quoted with comment",
+			content:  "spec:\n  targetRevision: \"v1.2.3\" # pinned\n",
+			path:     "spec.targetRevision",
+			old:      "v1.2.3",
+			expected: "spec:\n  targetRevision: \"v1.3.0\" # pinned\n",
+		},
+		{
+			name:     "single quoted",
+			content:  "spec:\n  targetRevision: 'v1.2.3'\n",
+			path:     "spec.targetRevision",
+			old:      "v1.2.3",
+			expected: "spec:\n  targetRevision: 'v1.3.0'\n",
+		},
+		{
+			name:     "flow mapping",
+			content:  "spec: {chart: redis, version: v1.2.3, repo: 'https://x'}\n",
+			path:     "spec.version",
+			old:      "v1.2.3",
+			expected: "spec: {chart: redis, version: v1.3.0, repo: 'https://x'}\n",
+		},
+		{
+			name:     "second document of a multi-document file",
+			content:  "kind: A\nversion: v1.2.3\n---\n# empty\n---\nkind: B\nversion: v1.2.3\n",
+			path:     "version",
+			doc:      1,
+			old:      "v1.2.3",
+			expected: "kind: A\nversion: v1.2.3\n---\n# empty\n---\nkind: B\nversion: v1.3.0\n",
+		},
+		{
+			name:     "anchored value",
+			content:  "a: &ver v1.2.3\nb: *ver\n",
+			path:     "a",
+			old:      "v1.2.3",
+			expected: "a: &ver v1.3.0\nb: *ver\n",
+		},
+		{
+			name:     "alias resolves to the anchor definition",
+			content:  "a: &ver v1.2.3\nb: *ver\n",
+			path:     "b",
+			old:      "v1.2.3",
+			expected: "a: &ver v1.3.0\nb: *ver\n",
+		},
+		{
+			name:     "value inherited through a merge key",
+			content:  "base: &base\n  version: v1.2.3\napp:\n  <<: *base\n  chart: redis\n",
+			path:     "app.version",
+			old:      "v1.2.3",
+			expected: "base: &base\n  version: v1.3.0\napp:\n  <<: *base\n  chart: redis\n",
+		},
+		{
+			name:     "already written through a shared anchor",
+			content:  "a: &ver v1.3.0\nb: *ver\n",
+			path:     "b",
+			old:      "v1.2.3",
+			expected: "a: &ver v1.3.0\nb: *ver\n",
+		},
+		{
+			name:     "non-ascii key before value",
+			content:  "spéc: {vérsion: \"v1.2.3\"}\n",
+			path:     "spéc.vérsion",
+			old:      "v1.2.3",
+			expected: "spéc: {vérsion: \"v1.3.0\"}\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := replaceAtPath([]byte(tc.content), tc.doc, tc.path, tc.old, "v1.3.0")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(out))
+		})
+	}
+}
+
+func TestWriteVersion_RefusesToGuess(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		path    string
+		doc     int
+		err     string
+	}{
+		{name: "missing path", content: "spec:\n  version: 1.2.3\n", path: "spec.chart.version", err: "not found"},
+		{name: "wrong document", content: "version: 1.2.3\n", path: "version", doc: 1, err: "document 1 not found"},
+		{name: "escaped quoted value", content: "version: \"1.2\\x2e3\"\n", path: "version", err: "contains escapes"},
+		{name: "not a scalar", content: "version:\n  a: 1\n", path: "version", err: "not a scalar"},
+		{name: "value changed", content: "version: 1.2.4\n", path: "version", err: "expected \"1.2.3\""},
+		{name: "folded embedded block", content: "values: >\n  tag: 1.2.3\n", path: "values|tag", err: "not a literal block"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := replaceAtPath([]byte(tc.content), tc.doc, tc.path, "1.2.3", "1.3.0")
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	_, err := replaceAtPath([]byte("version: 1.2.3\n"), 0, "version", "1.2.3", "1.3.0 # x")
+	assert.ErrorContains(t, err, "cannot be written as a plain scalar")
+}
+
+func TestAnchorDependents(t *testing.T) {
+	data := []byte(`defaults:
+  redis: &redisVersion 18.1.0
+apps:
+  - name: cache
+    version: *redisVersion
+  - name: queue
+    version: *redisVersion
+spec:
+  <<: &common
+    version: *redisVersion
+plain: 18.1.0
+`)
+	assert.Equal(t, []string{"apps[0].version", "apps[1].version", "spec.version"}, anchorDependents(data, 0, "defaults.redis"))
+	assert.Equal(t, []string{"defaults.redis", "apps[0].version", "apps[1].version"}, anchorDependents(data, 0, "spec.version"))
+	assert.Nil(t, anchorDependents(data, 0, "plain"))
+}
+
+func TestSourcesFor_UnknownSource(t *testing.T) {
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", mock.Anything).Return([]byte("charts:\n  - versionPath: spec.version\n    source: svn\n"), nil)
+
+	_, err := SourcesFor(&models.Config{SourcesFile: "custom.yaml"}, mockOS)
+	assert.ErrorContains(t, err, `unknown source "svn", expected one of chartmuseum, file, gcs, index, oci, s3`)
+
+	_, err = SourcesFor(&models.Config{RepoSources: []models.RepoSource{{URLPrefix: "https://cm.local", Source: "chartmusem"}}}, mockOS)
+	assert.ErrorContains(t, err, `unknown source "chartmusem" in repo_sources for https://cm.local`)
+}
@@ -0,0 +1,171 @@
+package argoaction
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+type fileSource struct {
+	u      *Updater
+	action internal.ActionInterface
+	osw    internal.OSInterface
+}
+
+func (s *fileSource) dir(repoURL string) string {
+	dir := repoURL
+	if i := strings.Index(dir, "://"); i >= 0 {
+		dir = dir[i+3:]
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(s.u.Config.Workspace, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+func (s *fileSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	dir := s.dir(ref.RepoURL)
+	index, err := s.u.indexes.get(indexURL(ref.RepoURL), ref.Chart, func(charts map[string]bool) (*models.Index, error) {
+		data, err := s.osw.ReadFile(filepath.Join(dir, "index.yaml"))
+		switch {
+		case err == nil:
+			index, err := decodeIndex(bytes.NewReader(data), charts)
+			if err != nil {
+				return nil, fmt.Errorf("decoding %s: %w", filepath.Join(dir, "index.yaml"), err)
+			}
+			return index, nil
+		case errors.Is(err, fs.ErrNotExist):
+			s.action.Debugf("No index.yaml in %s, indexing its chart archives", dir)
+			return s.indexArchives(dir, charts)
+		default:
+			return nil, err
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chartEntries(index, ref.Chart, dir, s.action), nil
+}
+
+func (s *fileSource) indexArchives(dir string, charts map[string]bool) (*models.Index, error) {
+	entries, err := s.osw.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := &models.Index{Entries: map[string][]models.ChartVersion{}}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".tgz") {
+			continue
+		}
+		data, err := s.osw.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		meta, err := archiveChart(data)
+		if err != nil {
+			s.action.Debugf("Skipping %s: %v", e.Name(), err)
+			continue
+		}
+		if !charts[meta.Name] {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		index.Entries[meta.Name] = append(index.Entries[meta.Name], models.ChartVersion{
+			Version:    meta.Version,
+			AppVersion: meta.AppVersion,
+			URLs:       []string{e.Name()},
+			Digest:     hex.EncodeToString(sum[:]),
+		})
+	}
+	return index, nil
+}
+
+type chartMetadata struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	AppVersion string `yaml:"appVersion"`
+}
+
+func archiveChart(data []byte) (*chartMetadata, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("no Chart.yaml found")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if strings.Count(hdr.Name, "/") != 1 || path.Base(hdr.Name) != "Chart.yaml" {
+			continue
+		}
+		var meta chartMetadata
+		if err := yaml.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&meta); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", hdr.Name, err)
+		}
+		if meta.Name == "" || meta.Version == "" {
+			return nil, fmt.Errorf("%s has no name or version", hdr.Name)
+		}
+		return &meta, nil
+	}
+}
+
+func (s *fileSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	versions, err := s.ListVersions(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return findVersion(versions, version, s.dir(ref.RepoURL))
+}
+
+func (s *fileSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	if len(version.URLs) == 0 {
+		return "", fmt.Errorf("the index entry has no urls")
+	}
+	var archive string
+	switch u := version.URLs[0]; {
+	case strings.HasPrefix(u, "file://"), filepath.IsAbs(u):
+		archive = s.dir(u)
+	case strings.Contains(u, "://"):
+		return (&indexSource{u: s.u, action: s.action}).Verify(ctx, ref, version)
+	default:
+		archive = filepath.Join(s.dir(ref.RepoURL), filepath.FromSlash(u))
+	}
+	data, err := s.osw.ReadFile(archive)
+	if err != nil {
+		return "", err
+	}
+	sum, err := archiveDigest(archive, data, version.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	sp := s.u.signaturePolicy(ref.RepoURL)
+	if sp == nil {
+		return "", nil
+	}
+	signer, err := checkProvenance(sp, s.osw, filepath.Base(archive), sum, func() ([]byte, error) {
+		return s.osw.ReadFile(archive + ".prov")
+	})
+	return applySignaturePolicy(sp, signer, err, ref.Chart, version.Version, s.action)
+}
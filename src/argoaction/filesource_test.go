@@ -0,0 +1,106 @@
+package argoaction
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+// dirEntry is a regular file entry returned by a mocked ReadDir.
+type dirEntry string
+
+func (e dirEntry) Name() string               { return string(e) }
+func (e dirEntry) IsDir() bool                { return false }
+func (e dirEntry) Type() fs.FileMode          { return 0 }
+func (e dirEntry) Info() (fs.FileInfo, error) { return nil, fs.ErrInvalid }
+
+func packageChart(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body))}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestFileSource_Index(t *testing.T) {
+	archive := []byte("chart archive")
+	sum := sha256.Sum256(archive)
+
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", "/srv/charts/index.yaml").Return([]byte("entries:\n  app:\n  - version: 1.1.0\n    urls: [app-1.1.0.tgz]\n    digest: "+hex.EncodeToString(sum[:])+"\n  - version: 1.0.0\n"), nil).Once()
+	mockOS.On("ReadFile", "/srv/charts/app-1.1.0.tgz").Return(archive, nil)
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	u := &Updater{Config: &models.Config{}, Action: mockAction, OS: mockOS}
+	ref := models.ChartRef{RepoURL: "file:///srv/charts", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	meta, err := src.Metadata(context.Background(), ref, "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", meta.Version)
+
+	note, err := src.Verify(context.Background(), ref, versions[0])
+	assert.NoError(t, err)
+	assert.Empty(t, note)
+
+	versions[0].Digest = "sha256:" + hex.EncodeToString(make([]byte, 32))
+	_, err = src.Verify(context.Background(), ref, versions[0])
+	assert.ErrorContains(t, err, "the index lists")
+	mockOS.AssertExpectations(t)
+}
+
+func TestFileSource_IndexesArchives(t *testing.T) {
+	app := packageChart(t, map[string]string{
+		"app/Chart.yaml":            "name: app\nversion: 2.0.0\nappVersion: \"5.1\"\n",
+		"app/charts/dep/Chart.yaml": "name: dep\nversion: 9.9.9\n",
+	})
+	other := packageChart(t, map[string]string{"other/Chart.yaml": "name: other\nversion: 1.0.0\n"})
+
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", "/work/charts/index.yaml").Return([]byte(nil), os.ErrNotExist)
+	mockOS.On("ReadDir", "/work/charts").Return([]os.DirEntry{dirEntry("README.md"), dirEntry("app-2.0.0.tgz"), dirEntry("other-1.0.0.tgz"), dirEntry("broken.tgz")}, nil).Once()
+	mockOS.On("ReadFile", "/work/charts/app-2.0.0.tgz").Return(app, nil)
+	mockOS.On("ReadFile", "/work/charts/other-1.0.0.tgz").Return(other, nil)
+	mockOS.On("ReadFile", "/work/charts/broken.tgz").Return([]byte("not gzip"), nil)
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	u := &Updater{Config: &models.Config{Workspace: "/work"}, Action: mockAction, OS: mockOS}
+	ref := models.ChartRef{RepoURL: "file://charts", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	sum := sha256.Sum256(app)
+	assert.Equal(t, []models.ChartVersion{{Version: "2.0.0", AppVersion: "5.1", URLs: []string{"app-2.0.0.tgz"}, Digest: hex.EncodeToString(sum[:])}}, versions)
+
+	note, err := src.Verify(context.Background(), ref, versions[0])
+	assert.NoError(t, err)
+	assert.Empty(t, note)
+	mockOS.AssertExpectations(t)
+}
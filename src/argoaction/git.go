@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/Masterminds/semver/v3"
 	githttp "github.com/go-git/go-git/v6/plumbing/transport/http"
 	"github.com/ironashram/argocd-apps-action/internal"
 	"github.com/ironashram/argocd-apps-action/models"
@@ -136,8 +135,9 @@ func (u *Updater) findExistingPR(ctx context.Context, branchName string) (*inter
 	return u.Provider.FindOpenPR(ctx, branchName)
 }
 
-func (u *Updater) handleChartGroup(ctx context.Context, chart string, newest *semver.Version, files []models.AppFile, osw internal.OSInterface) error {
-	branchName := "update-" + chart + "-" + newest.String()
+func (u *Updater) handleChartGroup(ctx context.Context, b bump, files []models.AppFile, osw internal.OSInterface) error {
+	chart, version := b.Chart, b.Version.Original()
+	branchName := "update-" + chart + "-" + version
 
 	existing, err := u.findExistingPR(ctx, branchName)
 	if err != nil {
@@ -161,14 +161,24 @@ func (u *Updater) handleChartGroup(ctx context.Context, chart string, newest *se
 	}
 
 	paths := make([]string, 0, len(files))
+	originals := map[string][]byte{}
 	for _, f := range files {
-		if err := u.updateVersion(f, newest, osw); err != nil {
+		if _, ok := originals[f.Path]; !ok {
+			data, err := osw.ReadFile(f.Path)
+			if err != nil {
+				u.restoreFiles(originals, osw)
+				return fmt.Errorf("reading %s: %w", f.Path, err)
+			}
+			originals[f.Path] = data
+		}
+		if err := u.updateVersion(f, b, osw); err != nil {
+			u.restoreFiles(originals, osw)
 			return fmt.Errorf("updating version for %s: %w", f.Path, err)
 		}
 		paths = append(paths, f.Path)
 	}
 
-	commitMessage := "chore: bump " + chart + " to version " + newest.String()
+	commitMessage := "chore: bump " + chart + " to version " + version
 	err = u.commitChanges(paths, commitMessage)
 	if err != nil {
 		if strings.Contains(err.Error(), "cannot create empty commit: clean working tree") {
@@ -187,8 +197,8 @@ func (u *Updater) handleChartGroup(ctx context.Context, chart string, newest *se
 		return fmt.Errorf("pushing changes: %w", err)
 	}
 
-	prTitle := "chore: bump " + chart + " to version " + newest.String()
-	prBody := buildPRBody(chart, newest, files, u.Config.Workspace)
+	prTitle := "chore: bump " + chart + " to version " + version
+	prBody := buildPRBody(b, files, u.Config.Workspace)
 	pr, err := u.createPullRequest(ctx, u.Config.TargetBranch, branchName, prTitle, prBody)
 	if err != nil {
 		return fmt.Errorf("creating pull request: %w", err)
@@ -204,16 +214,34 @@ func (u *Updater) handleChartGroup(ctx context.Context, chart string, newest *se
 	return nil
 }
 
-func buildPRBody(chart string, newest *semver.Version, files []models.AppFile, workspace string) string {
+func (u *Updater) restoreFiles(originals map[string][]byte, osw internal.OSInterface) {
+	for p, data := range originals {
+		if err := osw.WriteFile(p, data, 0644); err != nil {
+			u.Action.Infof("Error restoring %s: %v", p, err)
+		}
+	}
+}
+
+func buildPRBody(bp bump, files []models.AppFile, workspace string) string {
 	var b strings.Builder
-	fmt.Fprintf(&b, "This PR updates %s to version %s.\n\n", chart, newest)
+	fmt.Fprintf(&b, "This PR updates %s to version %s.\n\n", bp.Chart, bp.Version.Original())
 	fmt.Fprintln(&b, "Files updated:")
 	for _, f := range files {
 		display := f.Path
 		if rel, err := filepath.Rel(workspace, f.Path); err == nil {
 			display = rel
 		}
-		fmt.Fprintf(&b, "- %s (%s → %s)\n", display, f.CurrentVersion, newest)
+		written, err := formatVersion(f, bp)
+		if err != nil {
+			written = bp.published()
+		}
+		fmt.Fprintf(&b, "- %s (%s → %s)\n", display, rawVersion(f), written)
+		for _, d := range f.Dependents {
+			fmt.Fprintf(&b, "  - also changes %s, which shares the anchored value\n", d)
+		}
+	}
+	if bp.Signature != "" {
+		fmt.Fprintf(&b, "\n%s\n", bp.Signature)
 	}
 	return b.String()
 }
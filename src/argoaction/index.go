@@ -0,0 +1,120 @@
+package argoaction
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Block-style indexes are scanned line by line so memory does not grow with the repository.
+func decodeIndex(r io.Reader, charts map[string]bool) (*models.Index, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	index := &models.Index{Entries: map[string][]models.ChartVersion{}}
+
+	var head bytes.Buffer
+	var block bytes.Buffer
+	var blockChart string
+	inEntries := false
+	keyIndent := -1
+
+	flush := func() error {
+		if blockChart == "" {
+			return nil
+		}
+		var part models.Index
+		if err := yaml.Unmarshal(append([]byte("entries:\n"), block.Bytes()...), &part); err != nil {
+			return fmt.Errorf("decoding entries of %s: %w", blockChart, err)
+		}
+		for name, versions := range part.Entries {
+			index.Entries[name] = append(index.Entries[name], versions...)
+		}
+		block.Reset()
+		blockChart = ""
+		return nil
+	}
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		trimmed := bytes.TrimSpace(line)
+		indent := len(line) - len(bytes.TrimLeft(line, " "))
+		content := len(trimmed) > 0 && trimmed[0] != '#'
+
+		switch {
+		case !inEntries:
+			if content && indent == 0 {
+				if bytes.Equal(trimmed, []byte("entries:")) {
+					inEntries = true
+				} else if trimmed[0] == '{' || bytes.HasPrefix(trimmed, []byte("entries:")) {
+					return decodeWholeIndex(io.MultiReader(&head, bytes.NewReader(line), br), charts)
+				}
+			}
+			if !inEntries && keyIndent < 0 {
+				head.Write(line)
+			}
+		case !content:
+			if blockChart != "" {
+				block.Write(line)
+			}
+		case indent == 0:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			inEntries = false
+		case keyIndent < 0 || (indent == keyIndent && !bytes.HasPrefix(trimmed, []byte("-"))):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			keyIndent = indent
+			var key map[string]any
+			if err := yaml.Unmarshal(trimmed, &key); err != nil || len(key) != 1 {
+				return nil, fmt.Errorf("unsupported index layout at line %d", lineNo)
+			}
+			for name := range key {
+				if charts[name] {
+					blockChart = name
+					block.Write(line)
+				}
+			}
+		case indent < keyIndent:
+			return nil, fmt.Errorf("unsupported index layout at line %d", lineNo)
+		default:
+			if blockChart != "" {
+				block.Write(line)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func decodeWholeIndex(r io.Reader, charts map[string]bool) (*models.Index, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var index models.Index
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	for name := range index.Entries {
+		if !charts[name] {
+			delete(index.Entries, name)
+		}
+	}
+	return &index, nil
+}
@@ -0,0 +1,65 @@
+package argoaction
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestDecodeIndex(t *testing.T) {
+	const blockIndex = `apiVersion: v1
+entries:
+  alpine:
+  - apiVersion: v2
+    description: |
+      Deploy a basic Alpine Linux pod
+
+      with a blank line
+    version: 0.2.0
+  - appVersion: "3.19"
+    version: 0.1.0
+  # a comment between charts
+  "redis":
+  - annotations:
+      category: Database
+    appVersion: 7.2.4
+    urls:
+    - https://charts.example.com/redis-18.1.0.tgz
+    version: 18.1.0
+  empty: []
+generated: "2024-01-01T00:00:00Z"
+`
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{name: "block style", content: blockIndex},
+		{name: "crlf line endings", content: strings.ReplaceAll(blockIndex, "\n", "\r\n")},
+		{name: "json", content: `{"apiVersion":"v1","entries":{"alpine":[{"version":"0.2.0"},{"version":"0.1.0","appVersion":"3.19"}],"redis":[{"version":"18.1.0","appVersion":"7.2.4","urls":["https://charts.example.com/redis-18.1.0.tgz"]}]}}`},
+		{name: "flow entries", content: "apiVersion: v1\nentries: {alpine: [{version: 0.2.0}, {version: 0.1.0, appVersion: '3.19'}], redis: [{version: 18.1.0, appVersion: 7.2.4, urls: [https://charts.example.com/redis-18.1.0.tgz]}]}\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			index, err := decodeIndex(strings.NewReader(tc.content), map[string]bool{"redis": true, "missing": true})
+			assert.NoError(t, err)
+			assert.Equal(t, map[string][]models.ChartVersion{
+				"redis": {{Version: "18.1.0", AppVersion: "7.2.4", URLs: []string{"https://charts.example.com/redis-18.1.0.tgz"}}},
+			}, index.Entries)
+		})
+	}
+
+	index, err := decodeIndex(strings.NewReader(blockIndex), map[string]bool{"alpine": true, "empty": true})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "0.2.0"}, {Version: "0.1.0", AppVersion: "3.19"}}, index.Entries["alpine"])
+	assert.Empty(t, index.Entries["empty"])
+	assert.NotContains(t, index.Entries, "redis")
+}
+
+func TestDecodeIndex_UnsupportedLayout(t *testing.T) {
+	_, err := decodeIndex(strings.NewReader("entries:\n    a:\n    - version: 1.0.0\n  b: []\n"), map[string]bool{"a": true})
+	assert.ErrorContains(t, err, "unsupported index layout at line 4")
+}
@@ -0,0 +1,257 @@
+package argoaction
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+func isJSON(p string) bool {
+	return strings.EqualFold(filepath.Ext(p), ".json")
+}
+
+func decodeFile(p string, data []byte) ([]map[string]any, error) {
+	if isJSON(p) {
+		return decodeJSON(data)
+	}
+	return decodeDocs(data)
+}
+
+// Numbers keep their literal text so that a numeric pin reads back as written.
+func decodeJSON(data []byte) ([]map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var docs []map[string]any
+	for {
+		var d map[string]any
+		err := dec.Decode(&d)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return docs, err
+		}
+		if d != nil {
+			docs = append(docs, d)
+		}
+	}
+	return docs, nil
+}
+
+func replaceValue(file string, data []byte, docIndex int, p, oldValue, newest string) ([]byte, error) {
+	if isJSON(file) {
+		return replaceJSONAtPath(data, docIndex, p, oldValue, newest)
+	}
+	return replaceAtPath(data, docIndex, p, oldValue, newest)
+}
+
+func replaceJSONAtPath(data []byte, docIndex int, p, oldValue, newest string) ([]byte, error) {
+	if strings.Contains(p, "|") {
+		return nil, fmt.Errorf("%s: embedded YAML cannot be rewritten inside a JSON string", p)
+	}
+	sp, err := locateJSONValue(data, docIndex, splitPath(p))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if got := string(data[sp.start:sp.end]); got != oldValue {
+		return nil, fmt.Errorf("%s holds %q, expected %q", p, got, oldValue)
+	}
+	if strings.ContainsFunc(newest, func(r rune) bool { return r == '"' || r == '\\' || r < 0x20 }) {
+		return nil, fmt.Errorf("%s: %q cannot be written into a JSON string without escaping", p, newest)
+	}
+	return splice(data, sp.start, sp.end, newest), nil
+}
+
+// Top-level nulls are skipped, as decodeJSON does.
+func locateJSONValue(data []byte, docIndex int, parts []string) (span, error) {
+	s := &jsonScanner{data: data}
+	for idx := 0; ; {
+		s.skipSpace()
+		if s.pos >= len(data) {
+			return span{}, fmt.Errorf("document %d not found", docIndex)
+		}
+		if bytes.HasPrefix(data[s.pos:], []byte("null")) {
+			if err := s.skipValue(); err != nil {
+				return span{}, err
+			}
+			continue
+		}
+		if idx == docIndex {
+			if s.data[s.pos] != '{' {
+				return span{}, fmt.Errorf("document %d is not an object", docIndex)
+			}
+			sp, found, err := s.find(parts)
+			if err != nil {
+				return span{}, err
+			}
+			if !found {
+				return span{}, errors.New("path not found")
+			}
+			return sp, nil
+		}
+		if err := s.skipValue(); err != nil {
+			return span{}, err
+		}
+		idx++
+	}
+}
+
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) && isBlank(s.data[s.pos]) {
+		s.pos++
+	}
+}
+
+func (s *jsonScanner) expect(c byte) error {
+	s.skipSpace()
+	if s.pos >= len(s.data) || s.data[s.pos] != c {
+		return fmt.Errorf("expected %q at offset %d", c, s.pos)
+	}
+	s.pos++
+	return nil
+}
+
+// Duplicate keys are refused, as the decoder would silently pick the last one.
+func (s *jsonScanner) find(parts []string) (span, bool, error) {
+	s.skipSpace()
+	if len(parts) == 0 {
+		if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+			return span{}, false, fmt.Errorf("value at offset %d is not a string", s.pos)
+		}
+		start := s.pos + 1
+		raw, err := s.scanString()
+		if err != nil {
+			return span{}, false, err
+		}
+		if bytes.IndexByte(raw, '\\') >= 0 {
+			return span{}, false, fmt.Errorf("string at offset %d contains escapes", start)
+		}
+		return span{start: start, end: start + len(raw)}, true, nil
+	}
+	if s.pos >= len(s.data) || s.data[s.pos] != '{' {
+		return span{}, false, s.skipValue()
+	}
+	s.pos++
+
+	var sp span
+	found, seen := false, false
+	for first := true; ; first = false {
+		s.skipSpace()
+		if s.pos < len(s.data) && s.data[s.pos] == '}' {
+			s.pos++
+			return sp, found, nil
+		}
+		if !first {
+			if err := s.expect(','); err != nil {
+				return span{}, false, err
+			}
+			s.skipSpace()
+		}
+		raw, err := s.scanString()
+		if err != nil {
+			return span{}, false, err
+		}
+		var key string
+		if err := json.Unmarshal(append(append([]byte{'"'}, raw...), '"'), &key); err != nil {
+			return span{}, false, err
+		}
+		if err := s.expect(':'); err != nil {
+			return span{}, false, err
+		}
+		if key != parts[0] {
+			if err := s.skipValue(); err != nil {
+				return span{}, false, err
+			}
+			continue
+		}
+		if seen {
+			return span{}, false, fmt.Errorf("duplicate key %q", key)
+		}
+		seen = true
+		sp, found, err = s.find(parts[1:])
+		if err != nil {
+			return span{}, false, err
+		}
+	}
+}
+
+func (s *jsonScanner) scanString() ([]byte, error) {
+	if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+		return nil, fmt.Errorf("expected string at offset %d", s.pos)
+	}
+	start := s.pos + 1
+	for i := start; i < len(s.data); i++ {
+		switch s.data[i] {
+		case '\\':
+			i++
+		case '"':
+			s.pos = i + 1
+			if !utf8.Valid(s.data[start:i]) {
+				return nil, fmt.Errorf("invalid UTF-8 in string at offset %d", start)
+			}
+			return s.data[start:i], nil
+		}
+	}
+	return nil, fmt.Errorf("unterminated string at offset %d", start-1)
+}
+
+func (s *jsonScanner) skipValue() error {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return errors.New("unexpected end of JSON")
+	}
+	switch s.data[s.pos] {
+	case '"':
+		_, err := s.scanString()
+		return err
+	case '{', '[':
+		closing := byte('}')
+		if s.data[s.pos] == '[' {
+			closing = ']'
+		}
+		s.pos++
+		for first := true; ; first = false {
+			s.skipSpace()
+			if s.pos < len(s.data) && s.data[s.pos] == closing {
+				s.pos++
+				return nil
+			}
+			if !first {
+				if err := s.expect(','); err != nil {
+					return err
+				}
+			}
+			if closing == '}' {
+				s.skipSpace()
+				if _, err := s.scanString(); err != nil {
+					return err
+				}
+				if err := s.expect(':'); err != nil {
+					return err
+				}
+			}
+			if err := s.skipValue(); err != nil {
+				return err
+			}
+		}
+	default:
+		start := s.pos
+		for s.pos < len(s.data) && !isBlank(s.data[s.pos]) && !strings.ContainsRune(",}]", rune(s.data[s.pos])) {
+			s.pos++
+		}
+		if start == s.pos {
+			return fmt.Errorf("unexpected %q at offset %d", s.data[s.pos], s.pos)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package argoaction
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestReplaceJSONAtPath(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		path     string
+		doc      int
+		expected string
+	}{
+		{
+			name:     "minified",
+			content:  `{"spec":{"source":{"chart":"redis","targetRevision":"1.2.3","repoURL":"https://x"}}}`,
+			path:     "spec.source.targetRevision",
+			expected: `{"spec":{"source":{"chart":"redis","targetRevision":"1.3.0","repoURL":"https://x"}}}`,
+		},
+		{
+			name:     "indented with tabs",
+			content:  "{\n\t\"spec\": {\n\t\t\"version\" : \"1.2.3\"\n\t}\n}\n",
+			path:     "spec.version",
+			expected: "{\n\t\"spec\": {\n\t\t\"version\" : \"1.3.0\"\n\t}\n}\n",
+		},
+		{
+			name:     "same value in a sibling string",
+			content:  `{"note":"was 1.2.3","arr":[{"version":"1.2.3"}],"version":"1.2.3"}`,
+			path:     "version",
+			expected: `{"note":"was 1.2.3","arr":[{"version":"1.2.3"}],"version":"1.3.0"}`,
+		},
+		{
+			name:     "second value of a stream",
+			content:  "{\"version\":\"1.2.3\"}\n{\"version\":\"1.2.3\"}\n",
+			path:     "version",
+			doc:      1,
+			expected: "{\"version\":\"1.2.3\"}\n{\"version\":\"1.3.0\"}\n",
+		},
+		{
+			name:     "leading null not counted",
+			content:  "null\n{\"version\":\"1.2.3\"}\nnull\n{\"version\":\"1.2.3\"}\n",
+			path:     "version",
+			doc:      1,
+			expected: "null\n{\"version\":\"1.2.3\"}\nnull\n{\"version\":\"1.3.0\"}\n",
+		},
+		{
+			name:     "dotted key",
+			content:  `{"labels":{"app.kubernetes.io/version":"1.2.3"}}`,
+			path:     `labels.app\.kubernetes\.io/version`,
+			expected: `{"labels":{"app.kubernetes.io/version":"1.3.0"}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := decodeJSON([]byte(tc.content))
+			assert.NoError(t, err)
+			assert.Greater(t, len(docs), tc.doc)
+			out, err := replaceJSONAtPath([]byte(tc.content), tc.doc, tc.path, "1.2.3", "1.3.0")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(out))
+		})
+	}
+}
+
+func TestReplaceJSONAtPath_RefusesToGuess(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		path    string
+		err     string
+	}{
+		{name: "missing path", content: `{"spec":{}}`, path: "spec.version", err: "path not found"},
+		{name: "number", content: `{"version":1.2}`, path: "version", err: "not a string"},
+		{name: "escapes", content: `{"version":"1.2\u002e3"}`, path: "version", err: "contains escapes"},
+		{name: "duplicate key", content: `{"version":"1.2.3","version":"1.2.3"}`, path: "version", err: "duplicate key"},
+		{name: "embedded path", content: `{"values":"tag: 1.2.3"}`, path: "values|tag", err: "embedded YAML"},
+		{name: "value changed", content: `{"version":"1.2.4"}`, path: "version", err: `expected "1.2.3"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := replaceJSONAtPath([]byte(tc.content), 0, tc.path, "1.2.3", "1.3.0")
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	_, err := replaceJSONAtPath([]byte(`{"version":"1.2.3"}`), 0, "version", "1.2.3", `1.3.0"`)
+	assert.ErrorContains(t, err, "without escaping")
+}
+
+func TestUpdateVersion_JSON(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "app.json")
+	content := `{"spec":{"source":{"chart":"redis","repoURL":"https://charts.example.com","targetRevision":"v1.2.3"}}}`
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	u := &Updater{
+		Config: &models.Config{FileExtensions: []string{".yaml", ".json"}},
+		Action: mockAction,
+	}
+
+	candidates, errs := u.collectCandidates(dir, &internal.OSWrapper{})
+	assert.Empty(t, errs)
+	files := candidates[models.ChartRef{RepoURL: "https://charts.example.com", Chart: "redis"}]
+	assert.Len(t, files, 1)
+
+	err := u.updateVersion(files[0], bump{Chart: "redis", Version: semver.MustParse("1.3.0")}, &internal.OSWrapper{})
+	assert.NoError(t, err)
+	out, _ := os.ReadFile(p)
+	assert.Equal(t, `{"spec":{"source":{"chart":"redis","repoURL":"https://charts.example.com","targetRevision":"v1.3.0"}}}`, string(out))
+}
@@ -0,0 +1,145 @@
+package argoaction
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/ironashram/argocd-apps-action/cloudauth"
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+type objectStore interface {
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+type objectStoreSource struct {
+	u      *Updater
+	action internal.ActionInterface
+	scheme string
+}
+
+const maxArchiveBytes = 100 << 20
+
+func (u *Updater) objectStore(scheme, repoURL string, action internal.ActionInterface) (objectStore, error) {
+	key := scheme
+	if settings := tlsFor(u.Config.RepoTLS, repoURL); settings != nil {
+		key += "|" + settings.URLPrefix
+	}
+	u.stores.objectsMu.Lock()
+	defer u.stores.objectsMu.Unlock()
+	if store, ok := u.stores.objects[key]; ok {
+		return store, nil
+	}
+	client, err := u.httpClient(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	var store objectStore = &cloudauth.GCS{Client: client, Getenv: action.Getenv}
+	if scheme == "s3" {
+		store = &cloudauth.S3{Client: client, Getenv: action.Getenv}
+	}
+	if u.stores.objects == nil {
+		u.stores.objects = map[string]objectStore{}
+	}
+	u.stores.objects[key] = store
+	return store, nil
+}
+
+func splitBucketURL(url string) (bucket string, prefix string, err error) {
+	_, rest, ok := strings.Cut(url, "://")
+	bucket, prefix, _ = strings.Cut(rest, "/")
+	if !ok || bucket == "" {
+		return "", "", fmt.Errorf("%s is not a bucket URL", url)
+	}
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+func (s *objectStoreSource) get(ctx context.Context, repoURL, bucket, key string, maxBytes int64) ([]byte, error) {
+	store, err := s.u.objectStore(s.scheme, repoURL, s.action)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := store.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", key, err)
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", key, maxBytes)
+	}
+	return data, nil
+}
+
+func (s *objectStoreSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	bucket, prefix, err := splitBucketURL(ref.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	url := indexURL(ref.RepoURL)
+	index, err := s.u.indexes.get(url, ref.Chart, func(charts map[string]bool) (*models.Index, error) {
+		data, err := s.get(ctx, ref.RepoURL, bucket, path.Join(prefix, "index.yaml"), s.u.maxIndexBytes())
+		if err != nil {
+			return nil, err
+		}
+		index, err := decodeIndex(bytes.NewReader(data), charts)
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", url, err)
+		}
+		return index, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chartEntries(index, ref.Chart, url, s.action), nil
+}
+
+func (s *objectStoreSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	versions, err := s.ListVersions(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return findVersion(versions, version, "the index")
+}
+
+func (s *objectStoreSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	if len(version.URLs) == 0 {
+		return "", fmt.Errorf("the index entry has no urls")
+	}
+	archive := version.URLs[0]
+	if strings.HasPrefix(archive, "http://") || strings.HasPrefix(archive, "https://") {
+		return (&indexSource{u: s.u, action: s.action}).Verify(ctx, ref, version)
+	}
+	if !strings.Contains(archive, "://") {
+		archive = strings.TrimSuffix(ref.RepoURL, "/") + "/" + archive
+	}
+	bucket, key, err := splitBucketURL(archive)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.get(ctx, ref.RepoURL, bucket, key, maxArchiveBytes)
+	if err != nil {
+		return "", err
+	}
+	sum, err := archiveDigest(archive, data, version.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	sp := s.u.signaturePolicy(ref.RepoURL)
+	if sp == nil {
+		return "", nil
+	}
+	signer, err := checkProvenance(sp, s.u.fileSystem(), path.Base(key), sum, func() ([]byte, error) {
+		return s.get(ctx, ref.RepoURL, bucket, key+".prov", 1<<20)
+	})
+	return applySignaturePolicy(sp, signer, err, ref.Chart, version.Version, s.action)
+}
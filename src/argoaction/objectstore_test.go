@@ -0,0 +1,132 @@
+package argoaction
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestSplitBucketURL(t *testing.T) {
+	bucket, prefix, err := splitBucketURL("s3://charts-bucket/stable/")
+	require.NoError(t, err)
+	assert.Equal(t, "charts-bucket", bucket)
+	assert.Equal(t, "stable", prefix)
+
+	bucket, prefix, err = splitBucketURL("gs://charts-bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "charts-bucket", bucket)
+	assert.Empty(t, prefix)
+
+	_, _, err = splitBucketURL("s3:///charts")
+	assert.Error(t, err)
+}
+
+func TestObjectStoreSource_S3(t *testing.T) {
+	archive := []byte("chart archive")
+	sum := sha256.Sum256(archive)
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	signed := func(body []byte) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			assert.True(t, strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+			return httpmock.NewBytesResponse(200, body), nil
+		}
+	}
+	httpmock.RegisterResponder("GET", "http://s3.local/charts-bucket/stable/index.yaml", signed([]byte(`entries:
+  app:
+  - version: 1.1.0
+    urls: [s3://charts-bucket/stable/app-1.1.0.tgz]
+    digest: `+hex.EncodeToString(sum[:])+`
+  - version: 1.0.0
+    urls: [app-1.0.0.tgz]
+    digest: `+hex.EncodeToString(make([]byte, 32))+`
+`)))
+	httpmock.RegisterResponder("GET", "http://s3.local/charts-bucket/stable/app-1.1.0.tgz", signed(archive))
+	httpmock.RegisterResponder("GET", "http://s3.local/charts-bucket/stable/app-1.0.0.tgz", signed(archive))
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}, Env: map[string]string{
+		"AWS_ENDPOINT_URL_S3":   "http://s3.local",
+		"AWS_REGION":            "eu-west-1",
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	ref := models.ChartRef{RepoURL: "s3://charts-bucket/stable", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+
+	_, err = src.Verify(context.Background(), ref, versions[0])
+	assert.NoError(t, err)
+	_, err = src.Verify(context.Background(), ref, versions[1])
+	assert.ErrorContains(t, err, "the index lists")
+}
+
+func TestObjectStoreSource_GCS(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "/storage/v1/b/charts-bucket/o/index.yaml", req.URL.EscapedPath())
+		assert.Equal(t, "Bearer ya29.token", req.Header.Get("Authorization"))
+		return httpmock.NewStringResponse(200, "entries:\n  app: [{version: 2.0.0}]\n"), nil
+	})
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}, Env: map[string]string{
+		"STORAGE_EMULATOR_HOST":     "gcs.local:4443",
+		"GOOGLE_OAUTH_ACCESS_TOKEN": "ya29.token",
+	}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	ref := models.ChartRef{RepoURL: "gs://charts-bucket", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "2.0.0"}}, versions)
+}
+
+func TestObjectStoreSource_RepoTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/charts-bucket/index.yaml", r.URL.Path)
+		fmt.Fprint(w, "entries:\n  app: [{version: 1.0.0}]\n")
+	}))
+	defer server.Close()
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}, Env: map[string]string{
+		"AWS_ENDPOINT_URL_S3":       server.URL,
+		"AWS_EC2_METADATA_DISABLED": "true",
+		"HOME":                      t.TempDir(),
+	}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	ref := models.ChartRef{RepoURL: "s3://charts-bucket", Chart: "app"}
+	src, err := u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+	_, err = src.ListVersions(context.Background(), ref)
+	assert.ErrorContains(t, err, "certificate")
+
+	u = &Updater{Config: &models.Config{RepoTLS: []models.RepoTLS{{URLPrefix: "s3://charts-bucket", Insecure: true}}}, Action: mockAction}
+	src, err = u.sourceFor(ref, mockAction)
+	require.NoError(t, err)
+	versions, err := src.ListVersions(context.Background(), ref)
+	require.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "1.0.0"}}, versions)
+}
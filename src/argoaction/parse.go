@@ -2,6 +2,13 @@ package argoaction
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
 	"strings"
 
 	"github.com/ironashram/argocd-apps-action/internal"
@@ -9,11 +16,10 @@ import (
 	"github.com/ironashram/argocd-apps-action/utils"
 
 	"github.com/Masterminds/semver/v3"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/retry"
-
-	"sigs.k8s.io/yaml"
 )
 
 func stripScheme(u string) string {
@@ -24,14 +30,18 @@ func stripScheme(u string) string {
 }
 
 func credFor(creds []models.RepoCredential, url string) *models.RepoCredential {
+	return longestPrefix(creds, func(c models.RepoCredential) string { return c.URLPrefix }, url)
+}
+
+func longestPrefix[T any](items []T, prefix func(T) string, url string) *T {
 	target := stripScheme(url)
-	var best *models.RepoCredential
+	var best *T
 	bestLen := -1
-	for i, c := range creds {
-		prefix := stripScheme(c.URLPrefix)
-		if strings.HasPrefix(target, prefix) && len(prefix) > bestLen {
-			best = &creds[i]
-			bestLen = len(prefix)
+	for i, item := range items {
+		p := stripScheme(prefix(item))
+		if strings.HasPrefix(target, p) && len(p) > bestLen {
+			best = &items[i]
+			bestLen = len(p)
 		}
 	}
 	return best
@@ -55,65 +65,99 @@ func pickNewest(candidates []string, skipPreRelease bool, action internal.Action
 	return newest
 }
 
-func listVersionsFromNative(ctx context.Context, url string, chart string, cred *models.RepoCredential, action internal.ActionInterface) ([]string, error) {
-	var index models.Index
-
-	username, password := "", ""
-	if cred != nil {
-		username, password = cred.Username, cred.Password
+func credOptions(cred *models.RepoCredential, opts []utils.RequestOption) (string, string, []utils.RequestOption) {
+	if cred == nil {
+		return "", "", opts
 	}
-	body, err := utils.GetHTTPResponse(ctx, url, username, password)
+	switch cred.Type {
+	case models.CredentialBearer:
+		return "", "", append(opts, utils.WithBearerToken(cred.Token))
+	case models.CredentialHeader:
+		return "", "", append(opts, utils.WithHeader(cred.HeaderName, cred.HeaderValue))
+	default:
+		return cred.Username, cred.Password, opts
+	}
+}
+
+func fetchIndex(ctx context.Context, url string, charts map[string]bool, cred *models.RepoCredential, action internal.ActionInterface, opts ...utils.RequestOption) (*models.Index, error) {
+	username, password, opts := credOptions(cred, opts)
+	body, err := utils.OpenHTTPResponse(ctx, url, username, password, opts...)
 	if err != nil {
 		action.Debugf("failed to get HTTP response: %v", err)
 		return nil, err
 	}
+	defer body.Close()
 
-	err = yaml.Unmarshal(body, &index)
+	index, err := decodeIndex(body, charts)
 	if err != nil {
-		action.Debugf("failed to unmarshal YAML body: %v", err)
+		action.Debugf("failed to decode index %s: %v", url, err)
 		return nil, err
 	}
+	return index, nil
+}
 
+func chartEntries(index *models.Index, chart string, url string, action internal.ActionInterface) []models.ChartVersion {
 	if index.Entries == nil {
 		action.Debugf("No entries found in index at %s", url)
-		return nil, nil
+		return nil
 	}
 
 	entry, ok := index.Entries[chart]
 	if !ok || len(entry) == 0 {
 		action.Debugf("Chart entry %s does not exist or is empty at %s", chart, url)
-		return nil, nil
+		return nil
 	}
 
-	versions := make([]string, 0, len(entry))
-	for _, v := range entry {
-		versions = append(versions, v.Version)
-	}
-	return versions, nil
+	return entry
 }
 
-func listVersionsFromOCI(ctx context.Context, url string, chart string, cred *models.RepoCredential, action internal.ActionInterface) ([]string, error) {
+func ociRepository(url string, chart string, cred *models.RepoCredential, fallback auth.CredentialFunc, client *http.Client) (*remote.Repository, error) {
 	url = strings.TrimSuffix(url, "/") + "/" + chart
 	repo, err := remote.NewRepository(url)
 	if err != nil {
 		return nil, err
 	}
 
+	ac := &auth.Client{
+		Client: client,
+		Cache:  auth.NewCache(),
+	}
 	if cred != nil {
-		repo.Client = &auth.Client{
-			Client: retry.DefaultClient,
-			Cache:  auth.NewCache(),
-			Credential: auth.StaticCredential(repo.Reference.Registry, auth.Credential{
+		switch cred.Type {
+		case models.CredentialBearer:
+			ac.Credential = auth.StaticCredential(repo.Reference.Registry, auth.Credential{
+				AccessToken: cred.Token,
+			})
+		case models.CredentialHeader:
+			ac.Header = http.Header{}
+			ac.Header.Set(cred.HeaderName, cred.HeaderValue)
+		default:
+			ac.Credential = auth.StaticCredential(repo.Reference.Registry, auth.Credential{
 				Username: cred.Username,
 				Password: cred.Password,
-			}),
+			})
 		}
+	} else if fallback != nil {
+		ac.Credential = fallback
 	}
+	repo.Client = ac
+	return repo, nil
+}
 
-	var versions []string
+func listVersionsFromOCI(ctx context.Context, url string, chart string, cred *models.RepoCredential, fallback auth.CredentialFunc, client *http.Client, action internal.ActionInterface) ([]models.ChartVersion, error) {
+	repo, err := ociRepository(url, chart, cred, fallback, client)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.ChartVersion
 	err = repo.Tags(ctx, "", func(tagsResult []string) error {
 		for _, tag := range tagsResult {
-			versions = append(versions, strings.ReplaceAll(tag, "_", "+"))
+			v := models.ChartVersion{Version: strings.ReplaceAll(tag, "_", "+")}
+			if v.Version != tag {
+				v.Tag = tag
+			}
+			versions = append(versions, v)
 		}
 		return nil
 	})
@@ -124,3 +168,118 @@ func listVersionsFromOCI(ctx context.Context, url string, chart string, cred *mo
 
 	return versions, nil
 }
+
+func ociChartMetadata(ctx context.Context, url string, chart string, tag string, cred *models.RepoCredential, fallback auth.CredentialFunc, client *http.Client) (*models.ChartVersion, error) {
+	repo, err := ociRepository(url, chart, cred, fallback, client)
+	if err != nil {
+		return nil, err
+	}
+
+	_, manifest, err := ociManifest(ctx, repo, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := content.FetchAll(ctx, repo, manifest.Config)
+	if err != nil {
+		return nil, fmt.Errorf("fetching chart config: %w", err)
+	}
+	var meta struct {
+		Version    string `json:"version"`
+		AppVersion string `json:"appVersion"`
+	}
+	if err := json.Unmarshal(cfg, &meta); err != nil {
+		return nil, fmt.Errorf("decoding chart config: %w", err)
+	}
+	return &models.ChartVersion{Version: meta.Version, AppVersion: meta.AppVersion}, nil
+}
+
+const helmConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+
+func ociManifest(ctx context.Context, repo *remote.Repository, tag string) (ocispec.Descriptor, *ocispec.Manifest, error) {
+	desc, rc, err := repo.FetchReference(ctx, strings.ReplaceAll(tag, "+", "_"))
+	if err != nil {
+		return ocispec.Descriptor{}, nil, err
+	}
+	defer rc.Close()
+	var manifest ocispec.Manifest
+	if err := json.NewDecoder(io.LimitReader(rc, 4<<20)).Decode(&manifest); err != nil {
+		return ocispec.Descriptor{}, nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+	return desc, &manifest, nil
+}
+
+func ociVerifyChart(ctx context.Context, url string, chart string, tag string, cred *models.RepoCredential, fallback auth.CredentialFunc, client *http.Client) (*remote.Repository, ocispec.Descriptor, error) {
+	repo, err := ociRepository(url, chart, cred, fallback, client)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	desc, manifest, err := ociManifest(ctx, repo, tag)
+	if err != nil {
+		return nil, ocispec.Descriptor{}, err
+	}
+	if manifest.Config.MediaType != helmConfigMediaType {
+		return nil, ocispec.Descriptor{}, fmt.Errorf("tag %s is not a Helm chart (config media type %q)", tag, manifest.Config.MediaType)
+	}
+	return repo, desc, nil
+}
+
+func verifyChartArchive(ctx context.Context, url string, digest string, cred *models.RepoCredential, opts ...utils.RequestOption) (string, error) {
+	username, password, opts := credOptions(cred, opts)
+	body, err := utils.OpenHTTPResponse(ctx, url, username, password, opts...)
+	if err != nil {
+		return "", fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", fmt.Errorf("fetching %s: %w", url, err)
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if err := matchDigest(url, got, digest); err != nil {
+		return "", err
+	}
+	return got, nil
+}
+
+func archiveDigest(name string, data []byte, digest string) (string, error) {
+	h := sha256.Sum256(data)
+	sum := hex.EncodeToString(h[:])
+	if err := matchDigest(name, sum, digest); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+func matchDigest(name string, sum string, digest string) error {
+	if want := strings.TrimPrefix(digest, "sha256:"); want != "" && !strings.EqualFold(sum, want) {
+		return fmt.Errorf("digest of %s is %s, the index lists %s", name, sum, want)
+	}
+	return nil
+}
+
+func fetchProvenance(ctx context.Context, url string, cred *models.RepoCredential, opts ...utils.RequestOption) ([]byte, error) {
+	username, password, opts := credOptions(cred, opts)
+	body, err := utils.OpenHTTPResponse(ctx, url, username, password, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	return data, nil
+}
+
+func chartArchiveURL(repoURL string, u string) (string, error) {
+	base, err := neturl.Parse(strings.TrimSuffix(repoURL, "/") + "/")
+	if err != nil {
+		return "", err
+	}
+	ref, err := neturl.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
@@ -1,10 +1,14 @@
 package argoaction
 
 import (
+	"context"
+	"net/http"
 	"testing"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -57,3 +61,36 @@ func TestPickNewest(t *testing.T) {
 		})
 	}
 }
+
+func TestCredentialTypes(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://gitlab.local/index.yaml", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("PRIVATE-TOKEN") != "glpat" {
+			return httpmock.NewStringResponse(401, ""), nil
+		}
+		return httpmock.NewStringResponse(200, "entries:\n  app:\n  - version: 1.0.0\n"), nil
+	})
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/app/tags/list", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "Bearer tok" {
+			resp := httpmock.NewStringResponse(401, "")
+			resp.Header.Set("WWW-Authenticate", `Bearer realm="https://registry.local/token",service="registry.local"`)
+			return resp, nil
+		}
+		return httpmock.NewStringResponse(200, `{"tags":["1.0.0","1.1.0_build.2"]}`), nil
+	})
+
+	header := &models.RepoCredential{URLPrefix: "https://gitlab.local", Type: models.CredentialHeader, HeaderName: "PRIVATE-TOKEN", HeaderValue: "glpat"}
+	index, err := fetchIndex(context.Background(), "https://gitlab.local/index.yaml", map[string]bool{"app": true}, header, mockAction)
+	assert.NoError(t, err)
+	assert.Len(t, index.Entries["app"], 1)
+
+	bearer := &models.RepoCredential{URLPrefix: "registry.local", Type: models.CredentialBearer, Token: "tok"}
+	versions, err := listVersionsFromOCI(context.Background(), "registry.local/charts", "app", bearer, nil, http.DefaultClient, mockAction)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ChartVersion{{Version: "1.0.0"}, {Version: "1.1.0+build.2", Tag: "1.1.0_build.2"}}, versions)
+}
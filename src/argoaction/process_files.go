@@ -1,11 +1,13 @@
 package argoaction
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"path"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/ironashram/argocd-apps-action/internal"
@@ -15,14 +17,43 @@ import (
 func (u *Updater) CheckForUpdates(ctx context.Context) error {
 	dir := path.Join(u.Config.Workspace, u.Config.AppsFolder)
 
-	osw := &internal.OSWrapper{}
+	osw := u.fileSystem()
 	var errs []error
 
 	candidates, walkErrs := u.collectCandidates(dir, osw)
 	errs = append(errs, walkErrs...)
 
-	for key, files := range candidates {
-		if err := u.processChartGroup(ctx, key, files, osw); err != nil {
+	keys := make([]models.ChartRef, 0, len(candidates))
+	for key := range candidates {
+		keys = append(keys, key)
+		u.indexes.want(indexURL(key.RepoURL), key.Chart)
+	}
+	slices.SortFunc(keys, compareChartRefs)
+
+	// Logs are buffered per group and replayed in key order.
+	results := make([]*resolution, len(keys))
+	logs := make([]*actionLog, len(keys))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(u.concurrency(), len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				logs[i] = newActionLog(u.Action)
+				results[i] = u.resolveChartGroup(ctx, keys[i], candidates[keys[i]], logs[i])
+			}
+		}()
+	}
+	for i := range keys {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, key := range keys {
+		logs[i].replay()
+		if err := u.applyChartGroup(ctx, results[i], osw); err != nil {
 			u.Action.Debugf("Error processing chart group %s (%s): %v", key.Chart, key.RepoURL, err)
 			errs = append(errs, err)
 		}
@@ -31,27 +62,60 @@ func (u *Updater) CheckForUpdates(ctx context.Context) error {
 	return errors.Join(errs...)
 }
 
+const defaultConcurrency = 8
+
+func (u *Updater) concurrency() int {
+	if u.Config.Concurrency > 0 {
+		return u.Config.Concurrency
+	}
+	return defaultConcurrency
+}
+
+func compareChartRefs(a, b models.ChartRef) int {
+	return cmp.Or(
+		cmp.Compare(a.RepoURL, b.RepoURL),
+		cmp.Compare(a.Chart, b.Chart),
+		cmp.Compare(a.Source, b.Source),
+	)
+}
+
+type resolution struct {
+	bump  bump
+	files []models.AppFile
+}
+
 func (u *Updater) processChartGroup(ctx context.Context, key models.ChartRef, files []models.AppFile, osw internal.OSInterface) error {
-	u.Action.Debugf("Checking %s from %s (%d files)", key.Chart, key.RepoURL, len(files))
+	return u.applyChartGroup(ctx, u.resolveChartGroup(ctx, key, files, u.Action), osw)
+}
+
+func (u *Updater) applyChartGroup(ctx context.Context, r *resolution, osw internal.OSInterface) error {
+	if r == nil {
+		return nil
+	}
+	return u.handleChartGroup(ctx, r.bump, r.files, osw)
+}
 
-	cred := credFor(u.Config.RepoCreds, key.RepoURL)
-	versions, err := listVersionsFromNative(ctx, key.RepoURL+"/index.yaml", key.Chart, cred, u.Action)
-	if err != nil && !strings.Contains(err.Error(), "unsupported protocol scheme") {
-		u.Action.Infof("Error getting versions for %s: %v", key.Chart, err)
+func (u *Updater) resolveChartGroup(ctx context.Context, key models.ChartRef, files []models.AppFile, action internal.ActionInterface) *resolution {
+	action.Debugf("Checking %s from %s (%d files)", key.Chart, key.RepoURL, len(files))
+
+	src, err := u.sourceFor(key, action)
+	if err != nil {
+		action.Infof("Error getting versions for %s: %v", key.Chart, err)
 		return nil
 	}
+	versions, err := src.ListVersions(ctx, key)
 	if err != nil {
-		u.Action.Debugf("Not a native chart repository, trying OCI for %s", key.Chart)
-		versions, err = listVersionsFromOCI(ctx, key.RepoURL, key.Chart, cred, u.Action)
-		if err != nil {
-			u.Action.Infof("Error getting versions for %s: %v", key.Chart, err)
-			return nil
-		}
+		action.Infof("Error getting versions for %s: %v", key.Chart, err)
+		return nil
 	}
 
-	newest := pickNewest(versions, u.Config.SkipPreRelease, u.Action)
+	candidates := make([]string, 0, len(versions))
+	for _, v := range versions {
+		candidates = append(candidates, v.Version)
+	}
+	newest := pickNewest(candidates, u.Config.SkipPreRelease, action)
 	if newest == nil {
-		u.Action.Debugf("No newer version of %s is available", key.Chart)
+		action.Debugf("No newer version of %s is available", key.Chart)
 		return nil
 	}
 
@@ -59,7 +123,7 @@ func (u *Updater) processChartGroup(ctx context.Context, key models.ChartRef, fi
 	for _, f := range files {
 		current, err := semver.StrictNewVersion(strings.TrimPrefix(f.CurrentVersion, "v"))
 		if err != nil {
-			u.Action.Infof("Skipping %s: current version %q is not a fixed semver version", f.Path, f.CurrentVersion)
+			action.Infof("Skipping %s: current version %q is not a fixed semver version", f.Path, f.CurrentVersion)
 			continue
 		}
 		if current.LessThan(newest) {
@@ -68,18 +132,109 @@ func (u *Updater) processChartGroup(ctx context.Context, key models.ChartRef, fi
 	}
 
 	if len(toBump) == 0 {
-		u.Action.Debugf("No files need bumping for %s", key.Chart)
+		action.Debugf("No files need bumping for %s", key.Chart)
 		return nil
 	}
 
-	u.Action.Infof("There is a newer %s version: %s (%d file(s) to update)", key.Chart, newest, len(toBump))
+	action.Infof("There is a newer %s version: %s (%d file(s) to update)", key.Chart, newest, len(toBump))
 
 	if !u.Config.CreatePr {
-		u.Action.Infof("Create PR is disabled, skipping PR creation for %s", key.Chart)
+		action.Infof("Create PR is disabled, skipping PR creation for %s", key.Chart)
 		return nil
 	}
 
-	return u.handleChartGroup(ctx, key.Chart, newest, toBump, osw)
+	version, entry, signature, toBump := u.pullableVersion(ctx, src, key, versions, toBump, action)
+	if version == nil {
+		action.Infof("No newer version of %s could be verified, skipping", key.Chart)
+		return nil
+	}
+	if !version.Equal(newest) {
+		action.Infof("Falling back to %s %s (%d file(s) to update)", key.Chart, version, len(toBump))
+	}
+
+	b := bump{Chart: key.Chart, Version: version, Tag: entry.Tag, AppVersion: entry.AppVersion, Signature: signature}
+	if b.AppVersion == "" && needsAppVersion(toBump) {
+		meta, err := src.Metadata(ctx, key, version.Original())
+		if err != nil {
+			action.Debugf("Error reading chart metadata for %s %s: %v", key.Chart, version, err)
+		} else {
+			b.AppVersion = meta.AppVersion
+		}
+	}
+
+	return &resolution{bump: b, files: toBump}
+}
+
+func (u *Updater) pullableVersion(ctx context.Context, src VersionSource, key models.ChartRef, versions []models.ChartVersion, files []models.AppFile, action internal.ActionInterface) (*semver.Version, models.ChartVersion, string, []models.AppFile) {
+	type candidate struct {
+		version *semver.Version
+		entry   models.ChartVersion
+	}
+	var candidates []candidate
+	for _, entry := range versions {
+		v, err := semver.NewVersion(entry.Version)
+		if err != nil || (u.Config.SkipPreRelease && v.Prerelease() != "") {
+			continue
+		}
+		candidates = append(candidates, candidate{version: v, entry: entry})
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return b.version.Compare(a.version)
+	})
+
+	for _, c := range candidates {
+		behind := filesBehind(files, c.version)
+		if len(behind) == 0 {
+			break
+		}
+		signature, err := src.Verify(ctx, key, c.entry)
+		if err != nil {
+			action.Infof("Skipping %s %s: %v", key.Chart, c.version, err)
+			continue
+		}
+		return c.version, c.entry, signature, behind
+	}
+	return nil, models.ChartVersion{}, "", nil
+}
+
+func filesBehind(files []models.AppFile, v *semver.Version) []models.AppFile {
+	var behind []models.AppFile
+	for _, f := range files {
+		current, err := semver.StrictNewVersion(strings.TrimPrefix(f.CurrentVersion, "v"))
+		if err == nil && current.LessThan(v) {
+			behind = append(behind, f)
+		}
+	}
+	return behind
+}
+
+type bump struct {
+	Chart      string
+	Version    *semver.Version
+	Tag        string
+	AppVersion string
+	Signature  string
+}
+
+func (b bump) published() string {
+	if b.Tag != "" {
+		return b.Tag
+	}
+	return b.Version.Original()
+}
+
+func needsAppVersion(files []models.AppFile) bool {
+	for _, f := range files {
+		if strings.Contains(f.VersionTemplate, ".AppVersion") {
+			return true
+		}
+		for _, lf := range f.LinkedFields {
+			if strings.Contains(lf.Template, ".AppVersion") {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (u *Updater) matchesExtension(ext string) bool {
@@ -2,8 +2,12 @@ package argoaction
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -30,9 +34,7 @@ func TestProcessChartGroup_NewerVersion_CreatePrDisabled(t *testing.T) {
 	defer httpmock.DeactivateAndReset()
 
 	entries := models.Index{
-		Entries: map[string][]struct {
-			Version string `yaml:"version"`
-		}{
+		Entries: map[string][]models.ChartVersion{
 			"chart1": {{Version: "0.9.0"}, {Version: "0.8.0"}},
 		},
 	}
@@ -95,9 +97,7 @@ func TestProcessChartGroup_NonSemverVersionsSkipped(t *testing.T) {
 	defer httpmock.DeactivateAndReset()
 
 	entries := models.Index{
-		Entries: map[string][]struct {
-			Version string `yaml:"version"`
-		}{
+		Entries: map[string][]models.ChartVersion{
 			"mychart": {
 				{Version: "latest"},
 				{Version: "stable"},
@@ -137,9 +137,7 @@ func TestProcessChartGroup_NoBumpWhenAllAhead(t *testing.T) {
 	defer httpmock.DeactivateAndReset()
 
 	entries := models.Index{
-		Entries: map[string][]struct {
-			Version string `yaml:"version"`
-		}{
+		Entries: map[string][]models.ChartVersion{
 			"chart1": {{Version: "1.0.0"}},
 		},
 	}
@@ -173,9 +171,7 @@ func TestProcessChartGroup_OnlyFixedVersionsBumped(t *testing.T) {
 	defer httpmock.DeactivateAndReset()
 
 	entries := models.Index{
-		Entries: map[string][]struct {
-			Version string `yaml:"version"`
-		}{
+		Entries: map[string][]models.ChartVersion{
 			"chart1": {{Version: "7.0.0"}},
 		},
 	}
@@ -254,3 +250,170 @@ func TestCollectCandidates_GroupsByChartAndRepo(t *testing.T) {
 	assert.Len(t, candidates[fooKey], 2)
 	assert.Len(t, candidates[barKey], 1)
 }
+
+func TestCheckForUpdates_ResolvesConcurrentlyInKeyOrder(t *testing.T) {
+	dir := t.TempDir()
+	charts := []string{"delta", "alpha", "charlie", "bravo"}
+	for _, chart := range charts {
+		manifest := "spec:\n  source:\n    chart: " + chart + "\n    repoURL: https://charts.local\n    targetRevision: 1.0.0\n"
+		if err := os.WriteFile(dir+"/"+chart+".yaml", []byte(manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	index := "entries:\n"
+	for _, chart := range charts {
+		index += "  " + chart + ":\n  - version: 1.1.0\n"
+	}
+	httpmock.RegisterResponder("GET", "https://charts.local/index.yaml", httpmock.NewStringResponder(200, index))
+
+	var order []string
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).
+		Run(func(args mock.Arguments) {
+			order = append(order, args.Get(1).([]any)[0].(string))
+		}).Times(len(charts))
+	mockAction.On("Infof", "Create PR is disabled, skipping PR creation for %s", mock.Anything).Times(len(charts))
+
+	u := &Updater{
+		Config: &models.Config{Workspace: dir, FileExtensions: []string{".yaml"}, Concurrency: 3},
+		Action: mockAction,
+	}
+
+	assert.NoError(t, u.CheckForUpdates(context.Background()))
+	assert.Equal(t, []string{"alpha", "bravo", "charlie", "delta"}, order)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+	mockAction.AssertExpectations(t)
+}
+
+func TestResolveChartGroup_FallsBackToPullableVersion(t *testing.T) {
+	archive := []byte("chart archive")
+	sum := sha256.Sum256(archive)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://charts.local/index.yaml", httpmock.NewStringResponder(200, `entries:
+  app:
+  - version: 2.0.0
+    urls: [https://cdn.local/app-2.0.0.tgz]
+  - version: 1.5.0
+    urls: [app-1.5.0.tgz]
+    digest: 0000
+  - version: 1.2.0
+    appVersion: "9.9"
+    urls: [charts/app-1.2.0.tgz]
+    digest: `+hex.EncodeToString(sum[:])+`
+  - version: 1.1.0
+`))
+	httpmock.RegisterResponder("GET", "https://cdn.local/app-2.0.0.tgz", func(req *http.Request) (*http.Response, error) {
+		assert.Empty(t, req.Header.Get("Authorization"), "credentials must not leave the repository host")
+		return httpmock.NewStringResponse(404, ""), nil
+	})
+	httpmock.RegisterResponder("GET", "https://charts.local/app-1.5.0.tgz", httpmock.NewBytesResponder(200, archive))
+	httpmock.RegisterResponder("GET", "https://charts.local/charts/app-1.2.0.tgz", func(req *http.Request) (*http.Response, error) {
+		assert.NotEmpty(t, req.Header.Get("Authorization"))
+		return httpmock.NewBytesResponse(200, archive), nil
+	})
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Once()
+	mockAction.On("Infof", "Skipping %s %s: %v", mock.Anything).Twice()
+	mockAction.On("Infof", "Falling back to %s %s (%d file(s) to update)", mock.Anything).Once()
+
+	u := &Updater{
+		Config: &models.Config{CreatePr: true, RepoCreds: []models.RepoCredential{{URLPrefix: "https://charts.local", Username: "u", Password: "p"}}},
+		Action: mockAction,
+	}
+	key := models.ChartRef{RepoURL: "https://charts.local", Chart: "app"}
+	files := []models.AppFile{{Path: "a.yaml", CurrentVersion: "1.0.0"}, {Path: "b.yaml", CurrentVersion: "1.3.0"}}
+
+	r := u.resolveChartGroup(context.Background(), key, files, mockAction)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1.2.0", r.bump.Version.Original())
+		assert.Equal(t, "9.9", r.bump.AppVersion)
+		assert.Equal(t, []models.AppFile{files[0]}, r.files)
+	}
+	assert.Zero(t, httpmock.GetCallCountInfo()["GET https://charts.local/app-1.1.0.tgz"])
+	mockAction.AssertExpectations(t)
+}
+
+func TestResolveChartGroup_SkipsNonHelmOCIArtifacts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/tags/list",
+		httpmock.NewStringResponder(200, `{"name":"charts/foo","tags":["1.0.0","1.0.5","1.1.0"]}`))
+	manifest := func(tag, configType string) {
+		body := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"` + configType + `","digest":"sha256:` + strings.Repeat("0", 64) + `","size":2},"layers":[]}`
+		sum := sha256.Sum256([]byte(body))
+		responder := func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, body)
+			resp.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			resp.Header.Set("Docker-Content-Digest", "sha256:"+hex.EncodeToString(sum[:]))
+			resp.ContentLength = int64(len(body))
+			return resp, nil
+		}
+		httpmock.RegisterResponder("HEAD", "https://registry.local/v2/charts/foo/manifests/"+tag, responder)
+		httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/manifests/"+tag, responder)
+	}
+	manifest("1.1.0", "application/vnd.oci.image.config.v1+json")
+	manifest("1.0.5", helmConfigMediaType)
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Once()
+	mockAction.On("Infof", "Skipping %s %s: %v", mock.Anything).Once()
+	mockAction.On("Infof", "Falling back to %s %s (%d file(s) to update)", mock.Anything).Once()
+
+	u := &Updater{Config: &models.Config{CreatePr: true}, Action: mockAction}
+	key := models.ChartRef{RepoURL: "oci://registry.local/charts", Chart: "foo"}
+	r := u.resolveChartGroup(context.Background(), key, []models.AppFile{{Path: "a.yaml", CurrentVersion: "1.0.0"}}, mockAction)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1.0.5", r.bump.Version.Original())
+	}
+	mockAction.AssertExpectations(t)
+}
+
+func TestResolveChartGroup_OCIAppVersionForVersionTemplate(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/tags/list",
+		httpmock.NewStringResponder(200, `{"name":"charts/foo","tags":["1.0.0","1.1.0"]}`))
+	config := `{"name":"foo","version":"1.1.0","appVersion":"2.3.4"}`
+	configSum := sha256.Sum256([]byte(config))
+	body := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"` + helmConfigMediaType + `","digest":"sha256:` + hex.EncodeToString(configSum[:]) + `","size":` + strconv.Itoa(len(config)) + `},"layers":[]}`
+	sum := sha256.Sum256([]byte(body))
+	responder := func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(200, body)
+		resp.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		resp.Header.Set("Docker-Content-Digest", "sha256:"+hex.EncodeToString(sum[:]))
+		resp.ContentLength = int64(len(body))
+		return resp, nil
+	}
+	httpmock.RegisterResponder("HEAD", "https://registry.local/v2/charts/foo/manifests/1.1.0", responder)
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/manifests/1.1.0", responder)
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/blobs/sha256:"+hex.EncodeToString(configSum[:]), func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewStringResponse(200, config)
+		resp.ContentLength = int64(len(config))
+		return resp, nil
+	})
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Once()
+
+	u := &Updater{Config: &models.Config{CreatePr: true}, Action: mockAction}
+	key := models.ChartRef{RepoURL: "oci://registry.local/charts", Chart: "foo"}
+	f := models.AppFile{Path: "a.yaml", CurrentVersion: "1.0.0", VersionTemplate: "{{ .AppVersion }}"}
+	r := u.resolveChartGroup(context.Background(), key, []models.AppFile{f}, mockAction)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "2.3.4", r.bump.AppVersion)
+		value, err := formatVersion(f, r.bump)
+		assert.NoError(t, err)
+		assert.Equal(t, "2.3.4", value)
+	}
+	mockAction.AssertExpectations(t)
+}
@@ -0,0 +1,500 @@
+package argoaction
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"gopkg.in/yaml.v3"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+const (
+	cosignArtifactType        = "application/vnd.dev.cosign.artifact.sig.v1+json"
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	notationArtifactType      = "application/vnd.cncf.notary.signature"
+	notationJWSMediaType      = "application/jose+json"
+)
+
+func (u *Updater) signaturePolicy(repoURL string) *models.SignaturePolicy {
+	sp := longestPrefix(u.Config.SignaturePolicies, func(p models.SignaturePolicy) string { return p.URLPrefix }, repoURL)
+	if sp == nil || sp.Policy == models.SignatureOff {
+		return nil
+	}
+	resolved := *sp
+	resolved.Keyring = u.workspacePath(sp.Keyring)
+	resolved.CosignKey = u.workspacePath(sp.CosignKey)
+	resolved.NotationCert = u.workspacePath(sp.NotationCert)
+	return &resolved
+}
+
+func applySignaturePolicy(sp *models.SignaturePolicy, signer string, err error, chart string, version string, action internal.ActionInterface) (string, error) {
+	if err == nil {
+		return "Signature verified: " + signer + ".", nil
+	}
+	if sp.Policy == models.SignatureRequire {
+		return "", fmt.Errorf("signature verification failed: %w", err)
+	}
+	action.Infof("Signature of %s %s could not be verified: %v", chart, version, err)
+	return "Signature not verified: " + err.Error() + ".", nil
+}
+
+func checkProvenance(sp *models.SignaturePolicy, osi internal.OSInterface, name string, sum string, fetch func() ([]byte, error)) (string, error) {
+	if sp.Keyring == "" {
+		return "", fmt.Errorf("no keyring is configured")
+	}
+	keyring, err := loadKeyring(osi, sp.Keyring)
+	if err != nil {
+		return "", err
+	}
+	prov, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	return verifyProvenance(prov, keyring, name, sum)
+}
+
+func loadKeyring(osi internal.OSInterface, path string) (openpgp.EntityList, error) {
+	data, err := osi.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data)); err == nil {
+		return keyring, nil
+	}
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+	}
+	return keyring, nil
+}
+
+func verifyProvenance(prov []byte, keyring openpgp.EntityList, name string, sum string) (string, error) {
+	block, _ := clearsign.Decode(prov)
+	if block == nil {
+		return "", errors.New("the provenance file is not clearsigned")
+	}
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil)
+	if err != nil {
+		return "", fmt.Errorf("checking the provenance signature: %w", err)
+	}
+
+	_, files, ok := bytes.Cut(block.Plaintext, []byte("\n...\n"))
+	if !ok {
+		return "", errors.New("the provenance file lists no files")
+	}
+	var sums struct {
+		Files map[string]string `yaml:"files"`
+	}
+	if err := yaml.Unmarshal(files, &sums); err != nil {
+		return "", fmt.Errorf("decoding the provenance files: %w", err)
+	}
+	want, ok := sums.Files[name]
+	if !ok {
+		return "", fmt.Errorf("the provenance file does not list %s", name)
+	}
+	if !strings.EqualFold(strings.TrimPrefix(want, "sha256:"), sum) {
+		return "", fmt.Errorf("the provenance file lists %s for %s, the archive is sha256:%s", want, name, sum)
+	}
+
+	identity := fmt.Sprintf("key %X", signer.PrimaryKey.KeyId)
+	if id := signer.PrimaryIdentity(); id != nil {
+		identity = id.Name
+	}
+	return "Helm provenance signed by " + identity, nil
+}
+
+func verifyOCISignature(ctx context.Context, osi internal.OSInterface, repo *remote.Repository, subject ocispec.Descriptor, sp *models.SignaturePolicy) (string, error) {
+	var errs []error
+	if sp.CosignKey != "" {
+		signer, err := verifyCosign(ctx, osi, repo, subject, sp.CosignKey)
+		if err == nil {
+			return signer, nil
+		}
+		errs = append(errs, err)
+	}
+	if sp.NotationCert != "" {
+		signer, err := verifyNotation(ctx, osi, repo, subject, sp.NotationCert)
+		if err == nil {
+			return signer, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no cosign-key or notation-cert is configured")
+	}
+	return "", errors.Join(errs...)
+}
+
+func referrerManifests(ctx context.Context, repo *remote.Repository, subject ocispec.Descriptor, artifactType string) ([]ocispec.Manifest, error) {
+	var descs []ocispec.Descriptor
+	err := repo.Referrers(ctx, subject, artifactType, func(referrers []ocispec.Descriptor) error {
+		descs = append(descs, referrers...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers: %w", err)
+	}
+	manifests := make([]ocispec.Manifest, 0, len(descs))
+	for _, desc := range descs {
+		data, err := content.FetchAll(ctx, repo, desc)
+		if err != nil {
+			return nil, err
+		}
+		var m ocispec.Manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("decoding signature manifest: %w", err)
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+// Older cosign releases push the signature under the sha256-<digest>.sig tag.
+func verifyCosign(ctx context.Context, osi internal.OSInterface, repo *remote.Repository, subject ocispec.Descriptor, keyPath string) (string, error) {
+	key, err := loadPublicKey(osi, keyPath)
+	if err != nil {
+		return "", err
+	}
+	manifests, err := referrerManifests(ctx, repo, subject, cosignArtifactType)
+	if err != nil {
+		return "", err
+	}
+	if _, m, err := ociManifest(ctx, repo, strings.Replace(subject.Digest.String(), ":", "-", 1)+".sig"); err == nil {
+		manifests = append(manifests, *m)
+	}
+	if len(manifests) == 0 {
+		return "", errors.New("no cosign signature found")
+	}
+
+	for _, m := range manifests {
+		for _, layer := range m.Layers {
+			sig, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+			if err != nil || len(sig) == 0 {
+				continue
+			}
+			payload, err := content.FetchAll(ctx, repo, layer)
+			if err != nil {
+				return "", err
+			}
+			if verifyWithKey(key, payload, sig) != nil {
+				continue
+			}
+			var simple struct {
+				Critical struct {
+					Image struct {
+						Digest string `json:"docker-manifest-digest"`
+					} `json:"image"`
+				} `json:"critical"`
+			}
+			if json.Unmarshal(payload, &simple) == nil && simple.Critical.Image.Digest == subject.Digest.String() {
+				return "cosign signature verified with " + filepath.Base(keyPath), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no cosign signature of %s verifies with %s", subject.Digest, keyPath)
+}
+
+func verifyNotation(ctx context.Context, osi internal.OSInterface, repo *remote.Repository, subject ocispec.Descriptor, certPath string) (string, error) {
+	roots, err := loadCertPool(osi, certPath)
+	if err != nil {
+		return "", err
+	}
+	manifests, err := referrerManifests(ctx, repo, subject, notationArtifactType)
+	if err != nil {
+		return "", err
+	}
+	if len(manifests) == 0 {
+		return "", errors.New("no notation signature found")
+	}
+
+	var errs []error
+	for _, m := range manifests {
+		for _, layer := range m.Layers {
+			if layer.MediaType != notationJWSMediaType {
+				errs = append(errs, fmt.Errorf("unsupported notation envelope %s", layer.MediaType))
+				continue
+			}
+			envelope, err := content.FetchAll(ctx, repo, layer)
+			if err != nil {
+				return "", err
+			}
+			leaf, err := verifyNotationJWS(envelope, roots, subject.Digest)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			return "notation signature by " + leaf.Subject.CommonName, nil
+		}
+	}
+	return "", errors.Join(errs...)
+}
+
+const (
+	notationPayloadType          = "application/vnd.cncf.notary.payload.v1+json"
+	notationSigningScheme        = "io.cncf.notary.signingScheme"
+	notationSigningTime          = "io.cncf.notary.signingTime"
+	notationAuthenticSigningTime = "io.cncf.notary.authenticSigningTime"
+	notationExpiry               = "io.cncf.notary.expiry"
+)
+
+type notationHeader struct {
+	Alg                  string     `json:"alg"`
+	Cty                  string     `json:"cty"`
+	Crit                 []string   `json:"crit"`
+	SigningScheme        string     `json:"io.cncf.notary.signingScheme"`
+	SigningTime          *time.Time `json:"io.cncf.notary.signingTime"`
+	AuthenticSigningTime *time.Time `json:"io.cncf.notary.authenticSigningTime"`
+	Expiry               *time.Time `json:"io.cncf.notary.expiry"`
+}
+
+// See the notary signature specification for the checks of a JWS envelope.
+func verifyNotationJWS(envelope []byte, roots *x509.CertPool, subject digest.Digest) (*x509.Certificate, error) {
+	var jws struct {
+		Payload   string `json:"payload"`
+		Protected string `json:"protected"`
+		Signature string `json:"signature"`
+		Header    struct {
+			X5C [][]byte `json:"x5c"`
+		} `json:"header"`
+	}
+	if err := json.Unmarshal(envelope, &jws); err != nil {
+		return nil, fmt.Errorf("decoding notation envelope: %w", err)
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+	if err != nil {
+		return nil, fmt.Errorf("decoding notation header: %w", err)
+	}
+	header, err := parseNotationHeader(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jws.Header.X5C) == 0 {
+		return nil, errors.New("the notation signature has no certificate chain")
+	}
+	certs := make([]*x509.Certificate, 0, len(jws.Header.X5C))
+	for _, der := range jws.Header.X5C {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("parsing notation certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	leaf := certs[0]
+	if !slices.Contains(leaf.ExtKeyUsage, x509.ExtKeyUsageCodeSigning) || leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return nil, errors.New("the notation certificate is not a code signing certificate")
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}); err != nil {
+		return nil, fmt.Errorf("the notation certificate is not trusted: %w", err)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(jws.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decoding notation signature: %w", err)
+	}
+	if err := verifyJWS(leaf.PublicKey, header.Alg, []byte(jws.Protected+"."+jws.Payload), sig); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if header.Expiry != nil && now.After(*header.Expiry) {
+		return nil, fmt.Errorf("the notation signature expired on %s", header.Expiry.Format(time.RFC3339))
+	}
+	signed := header.SigningTime
+	if header.SigningScheme == "notary.x509.signingAuthority" {
+		signed = header.AuthenticSigningTime
+	}
+	if signed.After(now) || signed.Before(leaf.NotBefore) || signed.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("the notation signing time %s is outside the validity of its certificate", signed.Format(time.RFC3339))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("decoding notation payload: %w", err)
+	}
+	var target struct {
+		TargetArtifact ocispec.Descriptor `json:"targetArtifact"`
+	}
+	if err := json.Unmarshal(payload, &target); err != nil {
+		return nil, fmt.Errorf("decoding notation payload: %w", err)
+	}
+	if target.TargetArtifact.Digest != subject {
+		return nil, fmt.Errorf("the notation signature is for %s, not %s", target.TargetArtifact.Digest, subject)
+	}
+	return leaf, nil
+}
+
+func parseNotationHeader(protected []byte) (*notationHeader, error) {
+	var header notationHeader
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return nil, fmt.Errorf("decoding notation header: %w", err)
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(protected, &params); err != nil {
+		return nil, fmt.Errorf("decoding notation header: %w", err)
+	}
+	if header.Cty != notationPayloadType {
+		return nil, fmt.Errorf("unsupported notation payload type %q", header.Cty)
+	}
+	for _, name := range header.Crit {
+		switch name {
+		case notationSigningScheme, notationAuthenticSigningTime, notationExpiry:
+		default:
+			return nil, fmt.Errorf("unsupported critical notation header %q", name)
+		}
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("critical notation header %q is missing", name)
+		}
+	}
+	for _, name := range []string{notationSigningScheme, notationAuthenticSigningTime, notationExpiry} {
+		if _, ok := params[name]; ok && !slices.Contains(header.Crit, name) {
+			return nil, fmt.Errorf("notation header %q is not marked critical", name)
+		}
+	}
+	switch header.SigningScheme {
+	case "notary.x509":
+		if header.SigningTime == nil {
+			return nil, fmt.Errorf("the notation signature has no %s", notationSigningTime)
+		}
+	case "notary.x509.signingAuthority":
+		if header.AuthenticSigningTime == nil {
+			return nil, fmt.Errorf("the notation signature has no %s", notationAuthenticSigningTime)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported notation signing scheme %q", header.SigningScheme)
+	}
+	return &header, nil
+}
+
+var jwsAlgorithms = map[string]struct {
+	hash crypto.Hash
+	pss  bool
+}{
+	"PS256": {crypto.SHA256, true},
+	"PS384": {crypto.SHA384, true},
+	"PS512": {crypto.SHA512, true},
+	"ES256": {crypto.SHA256, false},
+	"ES384": {crypto.SHA384, false},
+	"ES512": {crypto.SHA512, false},
+}
+
+func verifyJWS(key crypto.PublicKey, alg string, signingInput []byte, sig []byte) error {
+	a, ok := jwsAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported notation signature algorithm %q", alg)
+	}
+	h := a.hash.New()
+	h.Write(signingInput)
+	sum := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !a.pss {
+			break
+		}
+		if err := rsa.VerifyPSS(k, a.hash, sum, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return errors.New("the notation signature does not verify")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		bits := k.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		if alg != map[int]string{256: "ES256", 384: "ES384", 521: "ES512"}[bits] || len(sig) != 2*size {
+			break
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, sum, r, s) {
+			return errors.New("the notation signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("notation signature algorithm %s does not match the certificate key", alg)
+}
+
+func loadPublicKey(osi internal.OSInterface, path string) (crypto.PublicKey, error) {
+	data, err := osi.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM public key", path)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func loadCertPool(osi internal.OSInterface, path string) (*x509.CertPool, error) {
+	data, err := osi.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+func verifyWithKey(key crypto.PublicKey, payload []byte, sig []byte) error {
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		hash := crypto.SHA256
+		switch k.Curve {
+		case elliptic.P384():
+			hash = crypto.SHA384
+		case elliptic.P521():
+			hash = crypto.SHA512
+		}
+		h := hash.New()
+		h.Write(payload)
+		if !ecdsa.VerifyASN1(k, h.Sum(nil), sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		h := crypto.SHA256.New()
+		h.Write(payload)
+		sum := h.Sum(nil)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, sum, sig) == nil {
+			return nil
+		}
+		return rsa.VerifyPSS(k, crypto.SHA256, sum, sig, nil)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, payload, sig) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
@@ -0,0 +1,290 @@
+package argoaction
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/jarcoal/httpmock"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexSourceVerify_Provenance(t *testing.T) {
+	archive := []byte("chart archive")
+	sum := sha256.Sum256(archive)
+
+	entity, err := openpgp.NewEntity("Chart Signer", "", "signer@example.com", nil)
+	require.NoError(t, err)
+	// The keyring is given relative to the workspace, as in the README.
+	dir := t.TempDir()
+	keyring := filepath.Join(".github", "keys", "charts.asc")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".github", "keys"), 0o755))
+	var pub bytes.Buffer
+	w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, keyring), pub.Bytes(), 0o600))
+
+	provFor := func(sum string) []byte {
+		var prov bytes.Buffer
+		w, err := clearsign.Encode(&prov, entity.PrivateKey, nil)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("name: app\nversion: 1.0.0\n\n...\nfiles:\n  app-1.0.0.tgz: sha256:" + sum + "\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		return prov.Bytes()
+	}
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://charts.local/app-1.0.0.tgz", httpmock.NewBytesResponder(200, archive))
+	version := models.ChartVersion{Version: "1.0.0", URLs: []string{"app-1.0.0.tgz"}}
+	key := models.ChartRef{RepoURL: "https://charts.local", Chart: "app"}
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "Signature of %s %s could not be verified: %v", mock.Anything).Once()
+
+	src := &indexSource{action: mockAction, u: &Updater{Config: &models.Config{
+		Workspace:         dir,
+		SignaturePolicies: []models.SignaturePolicy{{URLPrefix: "https://charts.local", Policy: models.SignatureRequire, Keyring: keyring}},
+	}}}
+
+	httpmock.RegisterResponder("GET", "https://charts.local/app-1.0.0.tgz.prov", httpmock.NewBytesResponder(200, provFor(hex.EncodeToString(sum[:]))))
+	note, err := src.Verify(context.Background(), key, version)
+	require.NoError(t, err)
+	assert.Equal(t, "Signature verified: Helm provenance signed by Chart Signer <signer@example.com>.", note)
+
+	httpmock.RegisterResponder("GET", "https://charts.local/app-1.0.0.tgz.prov", httpmock.NewBytesResponder(200, provFor(hex.EncodeToString(make([]byte, 32)))))
+	_, err = src.Verify(context.Background(), key, version)
+	assert.ErrorContains(t, err, "signature verification failed")
+
+	src.u.Config.SignaturePolicies[0].Policy = models.SignatureWarn
+	note, err = src.Verify(context.Background(), key, version)
+	require.NoError(t, err)
+	assert.Contains(t, note, "Signature not verified")
+
+	src.u.Config.SignaturePolicies[0].Policy = models.SignatureOff
+	note, err = src.Verify(context.Background(), key, version)
+	require.NoError(t, err)
+	assert.Empty(t, note)
+	mockAction.AssertExpectations(t)
+}
+
+func TestOCISourceVerify_Cosign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	serve := func(path, mediaType string, body []byte) ocispec.Descriptor {
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(body), Size: int64(len(body))}
+		responder := func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewBytesResponse(200, body)
+			resp.Header.Set("Content-Type", mediaType)
+			resp.Header.Set("Docker-Content-Digest", desc.Digest.String())
+			resp.ContentLength = desc.Size
+			return resp, nil
+		}
+		for _, p := range []string{path, desc.Digest.String()} {
+			kind := "manifests"
+			if mediaType != ocispec.MediaTypeImageManifest && mediaType != ocispec.MediaTypeImageIndex {
+				kind = "blobs"
+			}
+			httpmock.RegisterResponder("HEAD", "https://registry.local/v2/charts/foo/"+kind+"/"+p, responder)
+			httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/"+kind+"/"+p, responder)
+		}
+		return desc
+	}
+	marshal := func(v any) []byte {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return data
+	}
+
+	subject := serve("1.0.0", ocispec.MediaTypeImageManifest, marshal(ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: helmConfigMediaType, Digest: digest.FromString("{}"), Size: 2},
+	}))
+	subject.MediaType = ocispec.MediaTypeImageManifest
+
+	payload := marshal(map[string]any{"critical": map[string]any{"image": map[string]string{"docker-manifest-digest": subject.Digest.String()}}})
+	h := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, h[:])
+	require.NoError(t, err)
+	layer := serve("", "application/vnd.dev.cosign.simplesigning.v1+json", payload)
+	layer.Annotations = map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)}
+	sigManifest := serve("", ocispec.MediaTypeImageManifest, marshal(ocispec.Manifest{
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: cosignArtifactType,
+		Config:       ocispec.DescriptorEmptyJSON,
+		Layers:       []ocispec.Descriptor{layer},
+		Subject:      &subject,
+	}))
+	sigManifest.ArtifactType = cosignArtifactType
+	referrers := marshal(ocispec.Index{MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{sigManifest}})
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/referrers/"+subject.Digest.String(), func(req *http.Request) (*http.Response, error) {
+		resp := httpmock.NewBytesResponse(200, referrers)
+		resp.Header.Set("Content-Type", ocispec.MediaTypeImageIndex)
+		return resp, nil
+	})
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	src := &ociSource{action: mockAction, u: &Updater{Config: &models.Config{
+		SignaturePolicies: []models.SignaturePolicy{{URLPrefix: "oci://registry.local", Policy: models.SignatureRequire, CosignKey: keyFile}},
+	}}}
+	ref := models.ChartRef{RepoURL: "oci://registry.local/charts", Chart: "foo"}
+
+	note, err := src.Verify(context.Background(), ref, models.ChartVersion{Version: "1.0.0"})
+	require.NoError(t, err)
+	assert.Equal(t, "Signature verified: cosign signature verified with cosign.pub.", note)
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKIXPublicKey(&other.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	_, err = src.Verify(context.Background(), ref, models.ChartVersion{Version: "1.0.0"})
+	assert.ErrorContains(t, err, "no cosign signature")
+}
+
+func TestVerifyNotationJWS(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issue := func(usages ...x509.ExtKeyUsage) []byte {
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "Chart Publisher"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  usages,
+		}, ca, &leafKey.PublicKey, caKey)
+		require.NoError(t, err)
+		return der
+	}
+	leafDER := issue(x509.ExtKeyUsageCodeSigning)
+
+	subject := digest.FromString("manifest")
+	signingTime := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	header := func(extra map[string]any) map[string]any {
+		h := map[string]any{
+			"alg":                 "ES256",
+			"cty":                 notationPayloadType,
+			"crit":                []string{notationSigningScheme},
+			notationSigningScheme: "notary.x509",
+			notationSigningTime:   signingTime,
+		}
+		for k, v := range extra {
+			h[k] = v
+		}
+		return h
+	}
+	envelope := func(target digest.Digest, hdr map[string]any, leaf []byte) []byte {
+		rawHeader, err := json.Marshal(hdr)
+		require.NoError(t, err)
+		protected := base64.RawURLEncoding.EncodeToString(rawHeader)
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"targetArtifact":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + target.String() + `","size":1}}`))
+		h := sha256.Sum256([]byte(protected + "." + payload))
+		r, s, err := ecdsa.Sign(rand.Reader, leafKey, h[:])
+		require.NoError(t, err)
+		sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		data, err := json.Marshal(map[string]any{
+			"protected": protected,
+			"payload":   payload,
+			"signature": base64.RawURLEncoding.EncodeToString(sig),
+			"header":    map[string]any{"x5c": [][]byte{leaf, caDER}},
+		})
+		require.NoError(t, err)
+		return data
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	leaf, err := verifyNotationJWS(envelope(subject, header(nil), leafDER), roots, subject)
+	require.NoError(t, err)
+	assert.Equal(t, "Chart Publisher", leaf.Subject.CommonName)
+
+	expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	_, err = verifyNotationJWS(envelope(subject, header(map[string]any{"crit": []string{notationSigningScheme, notationExpiry}, notationExpiry: expiry}), leafDER), roots, subject)
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		envelope []byte
+		err      string
+	}{
+		{name: "other artifact", envelope: envelope(digest.FromString("other"), header(nil), leafDER), err: "is for"},
+		{name: "expired", envelope: envelope(subject, header(map[string]any{
+			"crit":         []string{notationSigningScheme, notationExpiry},
+			notationExpiry: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339),
+		}), leafDER), err: "expired"},
+		{name: "expiry not critical", envelope: envelope(subject, header(map[string]any{notationExpiry: expiry}), leafDER), err: "is not marked critical"},
+		{name: "unknown critical header", envelope: envelope(subject, header(map[string]any{
+			"crit":                              []string{notationSigningScheme, "io.cncf.notary.verificationPlugin"},
+			"io.cncf.notary.verificationPlugin": "plugin",
+		}), leafDER), err: "unsupported critical notation header"},
+		{name: "no signing time", envelope: envelope(subject, header(map[string]any{notationSigningTime: nil}), leafDER), err: "has no io.cncf.notary.signingTime"},
+		{name: "future signing time", envelope: envelope(subject, header(map[string]any{notationSigningTime: time.Now().Add(2 * time.Hour).UTC().Format(time.RFC3339)}), leafDER), err: "outside the validity"},
+		{name: "missing code signing EKU", envelope: envelope(subject, header(nil), issue(x509.ExtKeyUsageServerAuth)), err: "not a code signing certificate"},
+		{name: "no EKU", envelope: envelope(subject, header(nil), issue()), err: "not a code signing certificate"},
+		{name: "mismatched algorithm", envelope: envelope(subject, header(map[string]any{"alg": "PS256"}), leafDER), err: "does not match the certificate key"},
+		{name: "unknown algorithm", envelope: envelope(subject, header(map[string]any{"alg": "XES256"}), leafDER), err: "unsupported notation signature algorithm"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifyNotationJWS(tc.envelope, roots, subject)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+
+	_, err = verifyNotationJWS(envelope(subject, header(nil), leafDER), x509.NewCertPool(), subject)
+	assert.ErrorContains(t, err, "not trusted")
+}
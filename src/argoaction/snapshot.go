@@ -0,0 +1,136 @@
+package argoaction
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"sigs.k8s.io/yaml"
+)
+
+func LoadSnapshot(cfg *models.Config, osi internal.OSInterface) (*models.Snapshot, error) {
+	if cfg.VersionsSnapshot == "" {
+		return nil, nil
+	}
+	p := cfg.VersionsSnapshot
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(cfg.Workspace, p)
+	}
+	data, err := osi.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot models.Snapshot
+	if err := yaml.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", cfg.VersionsSnapshot, err)
+	}
+	return &snapshot, nil
+}
+
+func BuildSnapshot(ctx context.Context, cfg *models.Config, action internal.ActionInterface) (*models.Snapshot, error) {
+	osw := &internal.OSWrapper{}
+	sources, err := SourcesFor(cfg, osw)
+	if err != nil {
+		return nil, fmt.Errorf("loading sources config: %w", err)
+	}
+	u := &Updater{Config: cfg, Action: action, Sources: sources, OS: osw}
+
+	candidates, errs := u.collectCandidates(path.Join(cfg.Workspace, cfg.AppsFolder), osw)
+	keys := make([]models.ChartRef, 0, len(candidates))
+	for key := range candidates {
+		keys = append(keys, key)
+		u.indexes.want(indexURL(key.RepoURL), key.Chart)
+	}
+	slices.SortFunc(keys, compareChartRefs)
+
+	snapshot := &models.Snapshot{Generated: time.Now().UTC()}
+	for _, key := range keys {
+		// Keys differing only by source share an entry.
+		if slices.ContainsFunc(snapshot.Charts, func(c models.SnapshotChart) bool {
+			return c.RepoURL == key.RepoURL && c.Chart == key.Chart
+		}) {
+			continue
+		}
+		versions, err := u.snapshotVersions(ctx, key, candidates[key], action)
+		if err != nil {
+			action.Infof("Leaving %s (%s) out of the snapshot: %v", key.Chart, key.RepoURL, err)
+			errs = append(errs, err)
+			continue
+		}
+		snapshot.Charts = append(snapshot.Charts, models.SnapshotChart{RepoURL: key.RepoURL, Chart: key.Chart, Versions: versions})
+	}
+	return snapshot, errors.Join(errs...)
+}
+
+func (u *Updater) snapshotVersions(ctx context.Context, key models.ChartRef, files []models.AppFile, action internal.ActionInterface) ([]models.ChartVersion, error) {
+	src, err := u.sourceFor(key, action)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := src.ListVersions(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !needsAppVersion(files) {
+		return versions, nil
+	}
+
+	var oldest *semver.Version
+	for _, f := range files {
+		v, err := semver.NewVersion(f.CurrentVersion)
+		if err == nil && (oldest == nil || v.LessThan(oldest)) {
+			oldest = v
+		}
+	}
+	for i, entry := range versions {
+		v, err := semver.NewVersion(entry.Version)
+		if entry.AppVersion != "" || err != nil || (oldest != nil && !v.GreaterThan(oldest)) {
+			continue
+		}
+		meta, err := src.Metadata(ctx, key, entry.Version)
+		if err != nil {
+			action.Debugf("Error reading chart metadata for %s %s: %v", key.Chart, entry.Version, err)
+			continue
+		}
+		versions[i].AppVersion = meta.AppVersion
+	}
+	return versions, nil
+}
+
+type snapshotSource struct {
+	u        *Updater
+	snapshot *models.Snapshot
+}
+
+func (s *snapshotSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	for _, c := range s.snapshot.Charts {
+		if c.Chart == ref.Chart && strings.TrimSuffix(c.RepoURL, "/") == strings.TrimSuffix(ref.RepoURL, "/") {
+			return c.Versions, nil
+		}
+	}
+	return nil, fmt.Errorf("%s from %s is not in the versions snapshot", ref.Chart, ref.RepoURL)
+}
+
+func (s *snapshotSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	versions, err := s.ListVersions(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return findVersion(versions, version, "the versions snapshot")
+}
+
+func (s *snapshotSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	if sp := s.u.signaturePolicy(ref.RepoURL); sp != nil && sp.Policy == models.SignatureRequire {
+		return "", errors.New("signature_policy requires a signature check, which a versions snapshot cannot provide")
+	}
+	return fmt.Sprintf("Version read from the versions snapshot of %s; it was not pulled or signature checked.", s.snapshot.Generated.Format(time.RFC3339)), nil
+}
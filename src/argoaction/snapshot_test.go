@@ -0,0 +1,132 @@
+package argoaction
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestBuildSnapshot(t *testing.T) {
+	workspace := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(workspace, "apps"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(workspace, "apps", "podinfo.yaml"), []byte(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: podinfo
+    repoURL: https://charts.local
+    targetRevision: 6.5.0
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: foo
+    repoURL: registry.local/charts
+    targetRevision: 1.0.0
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: gone
+    repoURL: https://gone.local
+    targetRevision: 1.0.0
+`), 0o644))
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://charts.local/index.yaml",
+		httpmock.NewStringResponder(200, "entries:\n  podinfo:\n  - version: 6.6.0\n    appVersion: 6.6.0\n  - version: 6.5.0\n    appVersion: 6.5.0\n"))
+	httpmock.RegisterResponder("GET", "https://gone.local/index.yaml", httpmock.NewStringResponder(404, ""))
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/tags/list",
+		httpmock.NewStringResponder(200, `{"name":"charts/foo","tags":["1.0.0","1.1.0"]}`))
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "Leaving %s (%s) out of the snapshot: %v", mock.Anything).Once()
+
+	cfg := &models.Config{Workspace: workspace, AppsFolder: "apps", FileExtensions: []string{".yaml"}, Preset: "argocd"}
+	snapshot, err := BuildSnapshot(context.Background(), cfg, mockAction)
+	assert.Error(t, err)
+	require.NotNil(t, snapshot)
+	assert.Equal(t, []models.SnapshotChart{
+		{RepoURL: "https://charts.local", Chart: "podinfo", Versions: []models.ChartVersion{{Version: "6.6.0", AppVersion: "6.6.0"}, {Version: "6.5.0", AppVersion: "6.5.0"}}},
+		{RepoURL: "registry.local/charts", Chart: "foo", Versions: []models.ChartVersion{{Version: "1.0.0"}, {Version: "1.1.0"}}},
+	}, snapshot.Charts)
+	mockAction.AssertExpectations(t)
+}
+
+func TestResolveChartGroup_FromSnapshot(t *testing.T) {
+	data, err := json.Marshal(models.Snapshot{
+		Generated: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Charts: []models.SnapshotChart{
+			{RepoURL: "oci://registry.local/charts", Chart: "foo", Versions: []models.ChartVersion{{Version: "1.0.0"}, {Version: "1.2.0", AppVersion: "3.1"}}},
+		},
+	})
+	require.NoError(t, err)
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", "/work/versions.json").Return(data, nil).Once()
+	snapshot, err := LoadSnapshot(&models.Config{Workspace: "/work", VersionsSnapshot: "versions.json"}, mockOS)
+	require.NoError(t, err)
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Once()
+
+	u := &Updater{Config: &models.Config{CreatePr: true}, Action: mockAction, Snapshot: snapshot}
+	key := models.ChartRef{RepoURL: "oci://registry.local/charts/", Chart: "foo"}
+	r := u.resolveChartGroup(context.Background(), key, []models.AppFile{{Path: "a.yaml", CurrentVersion: "1.0.0"}}, mockAction)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1.2.0", r.bump.Version.Original())
+		assert.Equal(t, "3.1", r.bump.AppVersion)
+		assert.Equal(t, "Version read from the versions snapshot of 2026-10-01T12:00:00Z; it was not pulled or signature checked.", r.bump.Signature)
+	}
+	assert.Zero(t, httpmock.GetTotalCallCount())
+
+	mockAction.AssertExpectations(t)
+	mockOS.AssertExpectations(t)
+}
+
+func TestResolveChartGroup_FromSnapshotWithSignaturePolicy(t *testing.T) {
+	snapshot := &models.Snapshot{
+		Generated: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC),
+		Charts: []models.SnapshotChart{
+			{RepoURL: "oci://registry.local/charts", Chart: "foo", Versions: []models.ChartVersion{{Version: "1.0.0"}, {Version: "1.2.0"}}},
+		},
+	}
+	key := models.ChartRef{RepoURL: "oci://registry.local/charts", Chart: "foo"}
+	files := []models.AppFile{{Path: "a.yaml", CurrentVersion: "1.0.0"}}
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Twice()
+	mockAction.On("Infof", "Skipping %s %s: %v", mock.Anything).Once()
+	mockAction.On("Infof", "No newer version of %s could be verified, skipping", mock.Anything).Once()
+
+	u := &Updater{Config: &models.Config{CreatePr: true, SignaturePolicies: []models.SignaturePolicy{
+		{URLPrefix: "oci://registry.local", Policy: models.SignatureRequire, CosignKey: "cosign.pub"},
+	}}, Action: mockAction, Snapshot: snapshot}
+	assert.Nil(t, u.resolveChartGroup(context.Background(), key, files, mockAction))
+
+	u.Config.SignaturePolicies[0].Policy = models.SignatureWarn
+	r := u.resolveChartGroup(context.Background(), key, files, mockAction)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1.2.0", r.bump.Version.Original())
+		assert.Contains(t, r.bump.Signature, "it was not pulled or signature checked")
+	}
+	mockAction.AssertExpectations(t)
+}
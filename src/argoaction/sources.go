@@ -0,0 +1,299 @@
+package argoaction
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/ironashram/argocd-apps-action/utils"
+)
+
+type VersionSource interface {
+	ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error)
+	Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error)
+	Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error)
+}
+
+type sourceFactory func(u *Updater, action internal.ActionInterface) VersionSource
+
+var (
+	versionSources = map[string]sourceFactory{
+		"index": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &indexSource{u: u, action: action}
+		},
+		"oci": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &ociSource{u: u, action: action}
+		},
+		"chartmuseum": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &chartMuseumSource{index: indexSource{u: u, action: action}}
+		},
+		"file": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &fileSource{u: u, action: action, osw: u.fileSystem()}
+		},
+		"s3": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &objectStoreSource{u: u, action: action, scheme: "s3"}
+		},
+		"gcs": func(u *Updater, action internal.ActionInterface) VersionSource {
+			return &objectStoreSource{u: u, action: action, scheme: "gcs"}
+		},
+	}
+	sourceSchemes = map[string]string{
+		"http":  "index",
+		"https": "index",
+		"oci":   "oci",
+		"file":  "file",
+		"s3":    "s3",
+		"gs":    "gcs",
+		"":      "oci",
+	}
+)
+
+func sourceNames() []string {
+	names := make([]string, 0, len(versionSources))
+	for name := range versionSources {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (u *Updater) sourceFor(ref models.ChartRef, action internal.ActionInterface) (VersionSource, error) {
+	if u.Snapshot != nil {
+		return &snapshotSource{u: u, snapshot: u.Snapshot}, nil
+	}
+	name := ref.Source
+	if name == "" {
+		if rs := longestPrefix(u.Config.RepoSources, func(rs models.RepoSource) string { return rs.URLPrefix }, ref.RepoURL); rs != nil {
+			name = rs.Source
+		}
+	}
+	if name == "" {
+		scheme, _, ok := strings.Cut(ref.RepoURL, "://")
+		if !ok {
+			scheme = ""
+		}
+		var known bool
+		if name, known = sourceSchemes[strings.ToLower(scheme)]; !known {
+			return nil, fmt.Errorf("no version source for scheme %q of %s", scheme, ref.RepoURL)
+		}
+	}
+	factory, ok := versionSources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown version source %q, expected one of %s", name, strings.Join(sourceNames(), ", "))
+	}
+	return factory(u, action), nil
+}
+
+type indexSource struct {
+	u      *Updater
+	action internal.ActionInterface
+}
+
+func (s *indexSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	cred := s.u.httpCredential(ref.RepoURL, s.action)
+	rt, err := s.u.transportFor(ref.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	url := indexURL(ref.RepoURL)
+	index, err := s.u.indexes.get(url, ref.Chart, func(charts map[string]bool) (*models.Index, error) {
+		return fetchIndex(ctx, url, charts, cred, s.action,
+			utils.WithTransport(rt),
+			utils.WithCacheDir(s.u.Config.CacheDir),
+			utils.WithMaxBytes(s.u.maxIndexBytes()),
+			utils.WithRetries(s.u.Config.HTTPRetries),
+			utils.WithTimeout(s.u.Config.HTTPTimeout))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chartEntries(index, ref.Chart, url, s.action), nil
+}
+
+func (s *indexSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	versions, err := s.ListVersions(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return findVersion(versions, version, "the index")
+}
+
+func findVersion(versions []models.ChartVersion, version, where string) (*models.ChartVersion, error) {
+	for _, v := range versions {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("version %s not found in %s", version, where)
+}
+
+func (s *indexSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	if len(version.URLs) == 0 {
+		return "", fmt.Errorf("the index entry has no urls")
+	}
+	archive, err := chartArchiveURL(ref.RepoURL, version.URLs[0])
+	if err != nil {
+		return "", err
+	}
+	// The archive gets the credentials of its own host.
+	cred := s.u.httpCredential(archive, s.action)
+	if cred == nil && sameHost(archive, ref.RepoURL) {
+		cred = s.u.httpCredential(ref.RepoURL, s.action)
+	}
+	rt, err := s.u.transportFor(archive)
+	if err != nil {
+		return "", err
+	}
+	opts := []utils.RequestOption{
+		utils.WithTransport(rt),
+		utils.WithRetries(s.u.Config.HTTPRetries),
+		utils.WithTimeout(s.u.Config.HTTPTimeout),
+	}
+	sum, err := verifyChartArchive(ctx, archive, version.Digest, cred, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	sp := s.u.signaturePolicy(ref.RepoURL)
+	if sp == nil {
+		return "", nil
+	}
+	name := path.Base(archive)
+	if u, err := neturl.Parse(archive); err == nil {
+		name = path.Base(u.Path)
+	}
+	signer, err := checkProvenance(sp, s.u.fileSystem(), name, sum, func() ([]byte, error) {
+		return fetchProvenance(ctx, archive+".prov", cred, opts...)
+	})
+	return applySignaturePolicy(sp, signer, err, ref.Chart, version.Version, s.action)
+}
+
+func sameHost(a, b string) bool {
+	ua, err := neturl.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := neturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Host, ub.Host)
+}
+
+type ociSource struct {
+	u      *Updater
+	action internal.ActionInterface
+}
+
+func (s *ociSource) ListVersions(ctx context.Context, ref models.ChartRef) ([]models.ChartVersion, error) {
+	cred, fallback := s.u.ociCredential(ref.RepoURL, s.action)
+	client, err := s.u.httpClient(ref.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	return listVersionsFromOCI(ctx, stripScheme(ref.RepoURL), ref.Chart, cred, fallback, client, s.action)
+}
+
+func (s *ociSource) Metadata(ctx context.Context, ref models.ChartRef, version string) (*models.ChartVersion, error) {
+	cred, fallback := s.u.ociCredential(ref.RepoURL, s.action)
+	client, err := s.u.httpClient(ref.RepoURL)
+	if err != nil {
+		return nil, err
+	}
+	return ociChartMetadata(ctx, stripScheme(ref.RepoURL), ref.Chart, version, cred, fallback, client)
+}
+
+func (s *ociSource) Verify(ctx context.Context, ref models.ChartRef, version models.ChartVersion) (string, error) {
+	cred, fallback := s.u.ociCredential(ref.RepoURL, s.action)
+	client, err := s.u.httpClient(ref.RepoURL)
+	if err != nil {
+		return "", err
+	}
+	repo, desc, err := ociVerifyChart(ctx, stripScheme(ref.RepoURL), ref.Chart, version.Version, cred, fallback, client)
+	if err != nil {
+		return "", err
+	}
+
+	sp := s.u.signaturePolicy(ref.RepoURL)
+	if sp == nil {
+		return "", nil
+	}
+	signer, err := verifyOCISignature(ctx, s.u.fileSystem(), repo, desc, sp)
+	return applySignaturePolicy(sp, signer, err, ref.Chart, version.Version, s.action)
+}
+
+func indexURL(repoURL string) string {
+	return strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+}
+
+const defaultMaxIndexMB = 100
+
+func (u *Updater) maxIndexBytes() int64 {
+	mb := u.Config.MaxIndexMB
+	if mb <= 0 {
+		mb = defaultMaxIndexMB
+	}
+	return int64(mb) << 20
+}
+
+type indexCache struct {
+	mu      sync.Mutex
+	wanted  map[string]map[string]bool
+	entries map[string]*indexEntry
+}
+
+type indexEntry struct {
+	done   chan struct{}
+	charts map[string]bool
+	index  *models.Index
+	err    error
+}
+
+func (c *indexCache) want(url, chart string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.wanted == nil {
+		c.wanted = map[string]map[string]bool{}
+	}
+	if c.wanted[url] == nil {
+		c.wanted[url] = map[string]bool{}
+	}
+	c.wanted[url][chart] = true
+}
+
+func (c *indexCache) get(url, chart string, fetch func(charts map[string]bool) (*models.Index, error)) (*models.Index, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = map[string]*indexEntry{}
+	}
+	e, ok := c.entries[url]
+	owner := !ok || !e.charts[chart]
+	if owner {
+		charts := map[string]bool{chart: true}
+		for name := range c.wanted[url] {
+			charts[name] = true
+		}
+		if ok {
+			for name := range e.charts {
+				charts[name] = true
+			}
+		}
+		e = &indexEntry{done: make(chan struct{}), charts: charts}
+		c.entries[url] = e
+	}
+	c.mu.Unlock()
+
+	if !owner {
+		<-e.done
+		return e.index, e.err
+	}
+	e.index, e.err = fetch(e.charts)
+	close(e.done)
+	return e.index, e.err
+}
@@ -0,0 +1,138 @@
+package argoaction
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestSourceFor(t *testing.T) {
+	u := &Updater{Config: &models.Config{RepoSources: []models.RepoSource{{URLPrefix: "https://charts.example.com/museum", Source: "chartmuseum"}}}}
+
+	testCases := []struct {
+		name     string
+		ref      models.ChartRef
+		expected VersionSource
+		err      string
+	}{
+		{name: "https index", ref: models.ChartRef{RepoURL: "https://charts.example.com"}, expected: &indexSource{u: u}},
+		{name: "http index", ref: models.ChartRef{RepoURL: "HTTP://charts.example.com"}, expected: &indexSource{u: u}},
+		{name: "oci scheme", ref: models.ChartRef{RepoURL: "oci://ghcr.io/org"}, expected: &ociSource{u: u}},
+		{name: "file scheme", ref: models.ChartRef{RepoURL: "file:///srv/charts"}, expected: &fileSource{u: u, osw: &internal.OSWrapper{}}},
+		{name: "no scheme", ref: models.ChartRef{RepoURL: "registry-1.docker.io/bitnamicharts"}, expected: &ociSource{u: u}},
+		{name: "hint wins", ref: models.ChartRef{RepoURL: "https://ghcr.io/org", Source: "oci"}, expected: &ociSource{u: u}},
+		{name: "repo_sources", ref: models.ChartRef{RepoURL: "https://charts.example.com/museum/stable"}, expected: &chartMuseumSource{index: indexSource{u: u}}},
+		{name: "hint wins over repo_sources", ref: models.ChartRef{RepoURL: "https://charts.example.com/museum", Source: "index"}, expected: &indexSource{u: u}},
+		{name: "unknown scheme", ref: models.ChartRef{RepoURL: "ftp://charts"}, err: `no version source for scheme "ftp"`},
+		{name: "unknown hint", ref: models.ChartRef{RepoURL: "https://x", Source: "svn"}, err: `unknown version source "svn"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src, err := u.sourceFor(tc.ref, nil)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, src)
+		})
+	}
+}
+
+func TestProcessChartGroup_SchemelessIsOCI(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	mockAction.On("Infof", "There is a newer %s version: %s (%d file(s) to update)", mock.Anything).Once()
+	mockAction.On("Infof", "Create PR is disabled, skipping PR creation for %s", mock.Anything).Once()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://registry.local/v2/charts/foo/tags/list",
+		httpmock.NewStringResponder(200, `{"name":"charts/foo","tags":["1.0.0","1.1.0"]}`))
+
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	key := models.ChartRef{RepoURL: "registry.local/charts", Chart: "foo"}
+	files := []models.AppFile{{Path: "a.yaml", CurrentVersion: "1.0.0"}}
+
+	err := u.processChartGroup(context.Background(), key, files, &mocks.MockOS{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"GET https://registry.local/v2/charts/foo/tags/list": 1}, httpmock.GetCallCountInfo())
+	mockAction.AssertExpectations(t)
+}
+
+func TestIndexSource_SharesDownloads(t *testing.T) {
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://charts.local/index.yaml",
+		httpmock.NewStringResponder(200, "entries:\n  a: [{version: 1.0.0}]\n  b: [{version: 2.0.0}]\n"))
+
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	u.indexes.want("https://charts.local/index.yaml", "a")
+	u.indexes.want("https://charts.local/index.yaml", "b")
+	var wg sync.WaitGroup
+	for _, chart := range []string{"a", "b", "a", "b"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ref := models.ChartRef{RepoURL: "https://charts.local", Chart: chart}
+			src, _ := u.sourceFor(ref, mockAction)
+			versions, err := src.ListVersions(context.Background(), ref)
+			assert.NoError(t, err)
+			assert.Len(t, versions, 1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
+func TestIndexSourceVerify_ArchiveHostCredentials(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://files.local/app-1.0.0.tgz", func(req *http.Request) (*http.Response, error) {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "files" || password != "files-pass" {
+			return httpmock.NewStringResponse(401, ""), nil
+		}
+		return httpmock.NewStringResponse(200, "chart archive"), nil
+	})
+	httpmock.RegisterResponder("GET", "https://cdn.local/app-1.0.0.tgz", func(req *http.Request) (*http.Response, error) {
+		assert.Empty(t, req.Header.Get("Authorization"), "credentials must not leave their host")
+		return httpmock.NewStringResponse(200, "chart archive"), nil
+	})
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	src := &indexSource{action: mockAction, u: &Updater{Config: &models.Config{RepoCreds: []models.RepoCredential{
+		{URLPrefix: "https://charts.local", Username: "index", Password: "index-pass"},
+		{URLPrefix: "https://files.local", Username: "files", Password: "files-pass"},
+	}}}}
+	ref := models.ChartRef{RepoURL: "https://charts.local", Chart: "app"}
+
+	_, err := src.Verify(context.Background(), ref, models.ChartVersion{Version: "1.0.0", URLs: []string{"https://files.local/app-1.0.0.tgz"}})
+	assert.NoError(t, err)
+	_, err = src.Verify(context.Background(), ref, models.ChartVersion{Version: "1.0.0", URLs: []string{"https://cdn.local/app-1.0.0.tgz"}})
+	assert.NoError(t, err)
+}
+
+func TestFindVersion(t *testing.T) {
+	versions := []models.ChartVersion{{Version: "1.0.0"}, {Version: "1.1.0", AppVersion: "2.0"}}
+	v, err := findVersion(versions, "1.1.0", "the index")
+	assert.NoError(t, err)
+	assert.Equal(t, &models.ChartVersion{Version: "1.1.0", AppVersion: "2.0"}, v)
+
+	_, err = findVersion(versions, "1.2.0", "the index")
+	assert.EqualError(t, err, "version 1.2.0 not found in the index")
+}
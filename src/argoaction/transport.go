@@ -0,0 +1,51 @@
+package argoaction
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/ironashram/argocd-apps-action/utils"
+)
+
+type transportCache struct {
+	mu         sync.Mutex
+	transports map[string]http.RoundTripper
+}
+
+func tlsFor(settings []models.RepoTLS, url string) *models.RepoTLS {
+	return longestPrefix(settings, func(t models.RepoTLS) string { return t.URLPrefix }, url)
+}
+
+func (u *Updater) transportFor(repoURL string) (http.RoundTripper, error) {
+	settings := tlsFor(u.Config.RepoTLS, repoURL)
+	if settings == nil {
+		return nil, nil
+	}
+
+	u.transports.mu.Lock()
+	defer u.transports.mu.Unlock()
+	if rt, ok := u.transports.transports[settings.URLPrefix]; ok {
+		return rt, nil
+	}
+	cfg, err := utils.NewTLSConfig(u.fileSystem().ReadFile,
+		u.workspacePath(settings.CAFile), u.workspacePath(settings.CertFile), u.workspacePath(settings.KeyFile), settings.Insecure)
+	if err != nil {
+		return nil, fmt.Errorf("loading repo_tls for %s: %w", settings.URLPrefix, err)
+	}
+	if u.transports.transports == nil {
+		u.transports.transports = map[string]http.RoundTripper{}
+	}
+	rt := utils.NewTransport(cfg)
+	u.transports.transports[settings.URLPrefix] = rt
+	return rt, nil
+}
+
+func (u *Updater) httpClient(repoURL string) (*http.Client, error) {
+	rt, err := u.transportFor(repoURL)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewHTTPClient(u.Config.HTTPRetries, u.Config.HTTPTimeout, rt), nil
+}
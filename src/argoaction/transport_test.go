@@ -0,0 +1,43 @@
+package argoaction
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestTransportFor(t *testing.T) {
+	u := &Updater{Config: &models.Config{RepoTLS: []models.RepoTLS{
+		{URLPrefix: "https://charts.corp", Insecure: true},
+		{URLPrefix: "oci://harbor.corp", CAFile: "/nonexistent/ca.pem"},
+	}}}
+
+	rt, err := u.transportFor("https://example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, rt)
+
+	rt, err = u.transportFor("https://charts.corp/stable")
+	assert.NoError(t, err)
+	assert.NotNil(t, rt)
+	again, _ := u.transportFor("charts.corp/incubator")
+	assert.Same(t, rt, again)
+
+	_, err = u.httpClient("harbor.corp/library")
+	assert.ErrorContains(t, err, "loading repo_tls for oci://harbor.corp")
+}
+
+func TestTransportFor_WorkspacePaths(t *testing.T) {
+	mockOS := new(mocks.MockOS)
+	mockOS.On("ReadFile", "/workspace/certs/ca.pem").Return([]byte("not a certificate"), nil)
+	u := &Updater{
+		Config: &models.Config{Workspace: "/workspace", RepoTLS: []models.RepoTLS{{URLPrefix: "https://charts.corp", CAFile: "certs/ca.pem"}}},
+		OS:     mockOS,
+	}
+
+	_, err := u.transportFor("https://charts.corp")
+	assert.ErrorContains(t, err, "no PEM certificates found in /workspace/certs/ca.pem")
+	mockOS.AssertExpectations(t)
+}
@@ -3,6 +3,7 @@ package argoaction
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 
 	"github.com/ironashram/argocd-apps-action/internal"
 	"github.com/ironashram/argocd-apps-action/models"
@@ -14,6 +15,13 @@ type Updater struct {
 	Config   *models.Config
 	Action   internal.ActionInterface
 	Sources  *models.SourcesConfig
+	OS       internal.OSInterface
+	Snapshot *models.Snapshot
+
+	indexes    indexCache
+	stores     credentialStores
+	transports transportCache
+	museums    museumProbes
 }
 
 func StartUpdate(ctx context.Context, cfg *models.Config, action internal.ActionInterface) error {
@@ -27,6 +35,11 @@ func StartUpdate(ctx context.Context, cfg *models.Config, action internal.Action
 		return fmt.Errorf("loading sources config: %w", err)
 	}
 
+	snapshot, err := LoadSnapshot(cfg, &internal.OSWrapper{})
+	if err != nil {
+		return fmt.Errorf("loading versions snapshot: %w", err)
+	}
+
 	provider := internal.NewRestProvider(cfg.ApiURL, cfg.Owner, cfg.Name, cfg.Token, cfg.Provider)
 
 	u := &Updater{
@@ -35,6 +48,8 @@ func StartUpdate(ctx context.Context, cfg *models.Config, action internal.Action
 		Config:   cfg,
 		Action:   action,
 		Sources:  sources,
+		OS:       &internal.OSWrapper{},
+		Snapshot: snapshot,
 	}
 
 	err = u.CheckForUpdates(ctx)
@@ -44,3 +59,17 @@ func StartUpdate(ctx context.Context, cfg *models.Config, action internal.Action
 
 	return nil
 }
+
+func (u *Updater) fileSystem() internal.OSInterface {
+	if u.OS != nil {
+		return u.OS
+	}
+	return &internal.OSWrapper{}
+}
+
+func (u *Updater) workspacePath(p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(u.Config.Workspace, p)
+}
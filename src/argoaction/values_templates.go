@@ -0,0 +1,126 @@
+package argoaction
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+var (
+	valuesRefRe      = regexp.MustCompile(`\{\{-?\s*\.Values\.([A-Za-z0-9_.]+)\s*(?:\|\s*quote\s*)?-?\}\}`)
+	actionOnlyLineRe = regexp.MustCompile(`^\s*\{\{.*\}\}\s*$`)
+	templateExprRe   = regexp.MustCompile(`\{\{.*?\}\}`)
+	valuesSentinelRe = regexp.MustCompile(`VALUES_REF\(([A-Za-z0-9_.]+)\)`)
+)
+
+type valuesCandidate struct {
+	ref  models.ChartRef
+	file models.AppFile
+}
+
+func valuesExtract(f parsedFile, c models.ChartRule, index map[string]string, osw internal.OSInterface, action internal.ActionInterface) []valuesCandidate {
+	root, ok := chartRootFor(f.path, osw)
+	if !ok {
+		return nil
+	}
+	valuesPath := filepath.Join(root, "values.yaml")
+	data, err := osw.ReadFile(valuesPath)
+	if err != nil {
+		action.Debugf("Error reading %s: %v", valuesPath, err)
+		return nil
+	}
+	valuesDocs, err := decodeDocs(data)
+	if err != nil || len(valuesDocs) == 0 {
+		action.Debugf("Error parsing %s: %v", valuesPath, err)
+		return nil
+	}
+	values := valuesDocs[0]
+
+	docs, err := decodeDocs(substituteValuesRefs(f.raw))
+	if err != nil {
+		action.Debugf("Template %s cannot be resolved against values: %v", f.path, err)
+		return nil
+	}
+
+	var out []valuesCandidate
+	for _, doc := range docs {
+		m := valuesSentinelRe.FindStringSubmatch(getString(doc, c.VersionPath))
+		if m == nil {
+			continue
+		}
+		resolved, _ := resolveValuesRefs(doc, values).(map[string]any)
+		ref, ver, ok := extractChart(resolved, c, index)
+		if !ok {
+			continue
+		}
+		af := models.AppFile{
+			Path:           valuesPath,
+			CurrentVersion: ver,
+			VersionPath:    m[1],
+			DocIndex:       0,
+		}
+		if !applyVersionPattern(&af, c, action) {
+			continue
+		}
+		out = append(out, valuesCandidate{ref: ref, file: af})
+	}
+	return out
+}
+
+func chartRootFor(p string, osw internal.OSInterface) (string, bool) {
+	for dir := filepath.Dir(p); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if filepath.Base(dir) != "templates" {
+			continue
+		}
+		root := filepath.Dir(dir)
+		if _, err := osw.ReadFile(filepath.Join(root, "Chart.yaml")); err == nil {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+func substituteValuesRefs(data []byte) []byte {
+	lines := strings.Split(string(data), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = valuesRefRe.ReplaceAllString(line, "VALUES_REF($1)")
+		if actionOnlyLineRe.MatchString(line) {
+			continue
+		}
+		out = append(out, templateExprRe.ReplaceAllString(line, "TEMPLATE_EXPR"))
+	}
+	return []byte(strings.Join(out, "\n"))
+}
+
+func resolveValuesRefs(v any, values map[string]any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, val := range t {
+			out[k] = resolveValuesRefs(val, values)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, val := range t {
+			out[i] = resolveValuesRefs(val, values)
+		}
+		return out
+	case string:
+		return valuesSentinelRe.ReplaceAllStringFunc(t, func(s string) string {
+			return getString(values, valuesSentinelRe.FindStringSubmatch(s)[1])
+		})
+	default:
+		return v
+	}
+}
+
+func sameField(a models.AppFile) func(models.AppFile) bool {
+	return func(b models.AppFile) bool {
+		return a.Path == b.Path && a.VersionPath == b.VersionPath && a.DocIndex == b.DocIndex
+	}
+}
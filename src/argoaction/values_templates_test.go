@@ -0,0 +1,113 @@
+package argoaction
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+func TestCollectCandidates_ValuesTemplates(t *testing.T) {
+	dir := t.TempDir()
+
+	write := func(name, content string) {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("Chart.yaml", `apiVersion: v2
+name: apps
+version: 0.1.0
+`)
+	write("values.yaml", `apps:
+  redis:
+    enabled: true
+    version: 18.1.0
+  nginx:
+    version: 15.0.0
+repos:
+  bitnami: https://charts.bitnami.com/bitnami
+`)
+	write("templates/redis.yaml", `{{- if .Values.apps.redis.enabled }}
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: redis
+  namespace: {{ .Release.Namespace }}
+spec:
+  source:
+    chart: redis
+    repoURL: {{ .Values.repos.bitnami }}
+    targetRevision: {{ .Values.apps.redis.version }}
+{{- end }}
+`)
+	write("templates/redis-replica.yaml", `apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    chart: redis
+    repoURL: "{{ .Values.repos.bitnami }}"
+    targetRevision: "{{ .Values.apps.redis.version }}"
+`)
+	write("templates/nginx.yaml", `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: {{ .Release.Name }}-nginx
+spec:
+  source:
+    chart: nginx
+    repoURL: {{ .Values.repos.bitnami }}
+    targetRevision: 15.0.0
+`)
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	u := &Updater{
+		Config:  &models.Config{FileExtensions: []string{".yaml"}},
+		Action:  mockAction,
+		Sources: argocdPreset(false, true),
+	}
+
+	candidates, _ := u.collectCandidates(dir, &internal.OSWrapper{})
+
+	redis := models.ChartRef{RepoURL: "https://charts.bitnami.com/bitnami", Chart: "redis"}
+	assert.Len(t, candidates[redis], 1)
+	assert.Equal(t, filepath.Join(dir, "values.yaml"), candidates[redis][0].Path)
+	assert.Equal(t, "apps.redis.version", candidates[redis][0].VersionPath)
+	assert.Equal(t, "18.1.0", candidates[redis][0].CurrentVersion)
+
+	nginx := models.ChartRef{RepoURL: "https://charts.bitnami.com/bitnami", Chart: "nginx"}
+	assert.Empty(t, candidates[nginx])
+
+	data, err := os.ReadFile(filepath.Join(dir, "values.yaml"))
+	assert.NoError(t, err)
+	out, err := writeVersion(data, candidates[redis][0], "18.2.0")
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "    version: 18.2.0\n")
+	assert.Contains(t, string(out), "    version: 15.0.0\n")
+}
+
+func TestChartRootFor(t *testing.T) {
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", "/repo/apps/Chart.yaml").Return([]byte("name: apps"), nil)
+	mockOS.On("ReadFile", mock.Anything).Return([]byte(nil), os.ErrNotExist)
+
+	root, ok := chartRootFor("/repo/apps/templates/sub/app.yaml", mockOS)
+	assert.True(t, ok)
+	assert.Equal(t, "/repo/apps", root)
+
+	_, ok = chartRootFor("/repo/other/app.yaml", mockOS)
+	assert.False(t, ok)
+}
@@ -0,0 +1,164 @@
+package argoaction
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+func verifyRewrite(before, after []byte, f models.AppFile) error {
+	var problems []string
+	if f.Offset > 0 {
+		end := f.Offset + len(rawVersion(f))
+		tail := len(before) - end
+		if end > len(before) || len(after) < f.Offset+tail ||
+			!bytes.Equal(before[:f.Offset], after[:f.Offset]) ||
+			!bytes.Equal(before[end:], after[len(after)-tail:]) {
+			problems = append(problems, fmt.Sprintf("bytes outside of the version at offset %d changed", f.Offset))
+		}
+	} else {
+		problems = structuralDiff(before, after, f)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected changes:\n%s\n%s", strings.Join(problems, "\n"), lineDiff(before, after))
+}
+
+func structuralDiff(before, after []byte, f models.AppFile) []string {
+	old, err := decodeFile(f.Path, before)
+	if err != nil {
+		return []string{fmt.Sprintf("original no longer decodes: %v", err)}
+	}
+	cur, err := decodeFile(f.Path, after)
+	if err != nil {
+		return []string{fmt.Sprintf("rewritten file does not decode: %v", err)}
+	}
+	if len(old) != len(cur) {
+		return []string{fmt.Sprintf("document count changed from %d to %d", len(old), len(cur))}
+	}
+
+	allowed := map[string]bool{canonicalPath(f.VersionPath): true}
+	for _, lf := range f.LinkedFields {
+		allowed[canonicalPath(lf.Path)] = true
+	}
+	for _, d := range f.Dependents {
+		allowed[d] = true
+	}
+
+	var problems []string
+	for i := range old {
+		ok := map[string]bool{}
+		if i == f.DocIndex {
+			ok = allowed
+		}
+		diffValues(old[i], cur[i], "", ok, func(p string, a, b any) {
+			problems = append(problems, fmt.Sprintf("- document %d, %s: %v → %v", i, p, a, b))
+		})
+	}
+	return problems
+}
+
+func diffValues(a, b any, p string, allowed map[string]bool, report func(p string, a, b any)) {
+	am, aok := a.(map[string]any)
+	bm, bok := b.(map[string]any)
+	if aok && bok {
+		keys := map[string]bool{}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			diffValues(am[k], bm[k], joinPath(p, k), allowed, report)
+		}
+		return
+	}
+	al, aok := a.([]any)
+	bl, bok := b.([]any)
+	if aok && bok && len(al) == len(bl) {
+		for i := range al {
+			diffValues(al[i], bl[i], fmt.Sprintf("%s[%d]", p, i), allowed, report)
+		}
+		return
+	}
+	if reflect.DeepEqual(a, b) || allowed[p] {
+		return
+	}
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok && embeddedAllowed(p, allowed) {
+		var ai, bi map[string]any
+		if yaml.Unmarshal([]byte(as), &ai) == nil && yaml.Unmarshal([]byte(bs), &bi) == nil {
+			diffValues(ai, bi, p+"|", allowed, report)
+			return
+		}
+	}
+	report(p, a, b)
+}
+
+func embeddedAllowed(p string, allowed map[string]bool) bool {
+	for k := range allowed {
+		if strings.HasPrefix(k, p+"|") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(p, key string) string {
+	key = strings.ReplaceAll(key, ".", `\.`)
+	if p == "" || strings.HasSuffix(p, "|") {
+		return p + key
+	}
+	return p + "." + key
+}
+
+func canonicalPath(p string) string {
+	layers := strings.Split(p, "|")
+	for i, layer := range layers {
+		out := ""
+		for _, part := range splitPath(layer) {
+			out = joinPath(out, part)
+		}
+		layers[i] = out
+	}
+	return strings.Join(layers, "|")
+}
+
+func lineDiff(before, after []byte) string {
+	a := strings.Split(string(before), "\n")
+	b := strings.Split(string(after), "\n")
+	var out strings.Builder
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y string
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if i < len(a) && i < len(b) && x == y {
+			continue
+		}
+		if i < len(a) {
+			fmt.Fprintf(&out, "%d: -%s\n", i+1, x)
+		}
+		if i < len(b) {
+			fmt.Fprintf(&out, "%d: +%s\n", i+1, y)
+		}
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
@@ -0,0 +1,134 @@
+package argoaction
+
+import (
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/ironashram/argocd-apps-action/internal/mocks"
+	"github.com/ironashram/argocd-apps-action/models"
+)
+
+const verifyManifest = `kind: A
+spec:
+  version: 1.0.0
+---
+kind: B
+metadata:
+  labels:
+    chart-version: 1.0.0
+spec:
+  version: 1.0.0
+  values: |
+    image:
+      tag: 1.0.0
+`
+
+func TestVerifyRewrite(t *testing.T) {
+	f := models.AppFile{
+		VersionPath:    "spec.version",
+		CurrentVersion: "1.0.0",
+		DocIndex:       1,
+		LinkedFields:   []models.LinkedField{{Path: "metadata.labels.chart-version"}, {Path: "spec.values|image.tag"}},
+	}
+
+	allowed := `kind: A
+spec:
+  version: 1.0.0
+---
+kind: B
+metadata:
+  labels:
+    chart-version: 1.1.0
+spec:
+  version: 1.1.0
+  values: |
+    image:
+      tag: 1.1.0
+`
+	assert.NoError(t, verifyRewrite([]byte(verifyManifest), []byte(allowed), f))
+
+	wrongDoc := `kind: A
+spec:
+  version: 1.1.0
+---
+kind: B
+metadata:
+  labels:
+    chart-version: 1.0.0
+spec:
+  version: 1.1.0
+  values: |
+    image:
+      tag: 1.0.0
+`
+	err := verifyRewrite([]byte(verifyManifest), []byte(wrongDoc), f)
+	assert.ErrorContains(t, err, "document 0, spec.version: 1.0.0 → 1.1.0")
+	assert.ErrorContains(t, err, "3: -  version: 1.0.0")
+	assert.ErrorContains(t, err, "3: +  version: 1.1.0")
+
+	embedded := `kind: A
+spec:
+  version: 1.0.0
+---
+kind: B
+metadata:
+  labels:
+    chart-version: 1.0.0
+spec:
+  version: 1.1.0
+  values: |
+    image:
+      tag: 1.0.0
+      pullPolicy: Always
+`
+	err = verifyRewrite([]byte(verifyManifest), []byte(embedded), f)
+	assert.ErrorContains(t, err, "spec.values|image.pullPolicy")
+
+	err = verifyRewrite([]byte(verifyManifest), []byte("kind: A\n"), f)
+	assert.ErrorContains(t, err, "document count changed from 2 to 1")
+}
+
+func TestVerifyRewrite_Offset(t *testing.T) {
+	before := "spec:\n  chart: {{ .Values.chart }}\n  targetRevision: 1.2.3\n"
+	f := models.AppFile{VersionPath: "spec.targetRevision", CurrentVersion: "1.2.3", Offset: len(before) - len("1.2.3\n")}
+
+	assert.NoError(t, verifyRewrite([]byte(before), []byte("spec:\n  chart: {{ .Values.chart }}\n  targetRevision: 1.10.0\n"), f))
+	assert.Error(t, verifyRewrite([]byte(before), []byte("spec:\n  chart: {{ .Values.other }}\n  targetRevision: 1.10.0\n"), f))
+}
+
+func TestUpdateVersion_RestoresOnUnexpectedChange(t *testing.T) {
+	original := []byte("spec:\n  name: app\n  version: 1.0.0\n")
+	corrupted := []byte("spec:\n  name: other\n  version: 1.1.0\n")
+
+	mockAction := &mocks.MockActionInterface{Inputs: map[string]string{}}
+	mockAction.On("Infof", "Rewrite of %s did not only change %s, restoring it: %v", mock.Anything).Once()
+
+	mockOS := &mocks.MockOS{}
+	mockOS.On("ReadFile", "a.yaml").Return(original, nil).Once()
+	mockOS.On("WriteFile", "a.yaml", mock.Anything, mock.Anything).Return(nil).Once()
+	mockOS.On("ReadFile", "a.yaml").Return(corrupted, nil).Once()
+	mockOS.On("WriteFile", "a.yaml", original, mock.Anything).Return(nil).Once()
+
+	u := &Updater{Config: &models.Config{}, Action: mockAction}
+	f := models.AppFile{Path: "a.yaml", VersionPath: "spec.version", CurrentVersion: "1.0.0"}
+	err := u.updateVersion(f, bump{Chart: "app", Version: semver.MustParse("1.1.0")}, mockOS)
+
+	assert.ErrorContains(t, err, "spec.name: app → other")
+	mockOS.AssertExpectations(t)
+	mockAction.AssertExpectations(t)
+}
+
+func TestVerifyRewrite_AnchorDependents(t *testing.T) {
+	before := []byte("base: &v 1.0.0\napps:\n  - version: *v\n  - version: 2.0.0\n")
+	after := []byte("base: &v 1.1.0\napps:\n  - version: *v\n  - version: 2.0.0\n")
+	f := models.AppFile{VersionPath: "base", CurrentVersion: "1.0.0"}
+
+	assert.ErrorContains(t, verifyRewrite(before, after, f), "apps[0].version: 1.0.0 → 1.1.0")
+
+	f.Dependents = anchorDependents(before, 0, "base")
+	assert.Equal(t, []string{"apps[0].version"}, f.Dependents)
+	assert.NoError(t, verifyRewrite(before, after, f))
+}
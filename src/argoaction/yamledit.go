@@ -0,0 +1,365 @@
+package argoaction
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ironashram/argocd-apps-action/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+var plainSafeRe = regexp.MustCompile(`^[^\s,\[\]{}#&*!|>'"%@` + "`" + `][^\s,\[\]{}#]*$`)
+
+type span struct {
+	start int
+	end   int
+	style yaml.Style
+}
+
+func writeVersion(data []byte, f models.AppFile, newest string) ([]byte, error) {
+	if f.Offset > 0 {
+		return replaceAtOffset(data, f.Offset, rawVersion(f), newest)
+	}
+	return replaceValue(f.Path, data, f.DocIndex, f.VersionPath, rawVersion(f), newest)
+}
+
+func replaceAtOffset(data []byte, off int, oldValue, newest string) ([]byte, error) {
+	end := off + len(oldValue)
+	if oldValue == "" || end > len(data) || string(data[off:end]) != oldValue {
+		return nil, fmt.Errorf("version %q not found at offset %d", oldValue, off)
+	}
+	return splice(data, off, end, newest), nil
+}
+
+func replaceAtPath(data []byte, docIndex int, p, oldValue, newest string) ([]byte, error) {
+	sp, err := locateValue(data, docIndex, p)
+	if err != nil {
+		return nil, err
+	}
+	got := string(data[sp.start:sp.end])
+	if got == newest && got != oldValue {
+		// Already rewritten through another path sharing the same anchor.
+		return data, nil
+	}
+	if got != oldValue {
+		return nil, fmt.Errorf("%s holds %q, expected %q", p, got, oldValue)
+	}
+	if err := fitsStyle(newest, sp.style); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return splice(data, sp.start, sp.end, newest), nil
+}
+
+func splice(data []byte, start, end int, value string) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(value))
+	out = append(out, data[:start]...)
+	out = append(out, value...)
+	return append(out, data[end:]...)
+}
+
+func locateValue(data []byte, docIndex int, p string) (span, error) {
+	root, err := documentNode(data, docIndex)
+	if err != nil {
+		return span{}, err
+	}
+	layers := strings.SplitN(p, "|", 2)
+	n := nodeAtPath(root, splitPath(layers[0]))
+	if n == nil {
+		return span{}, fmt.Errorf("path %s not found in document %d", layers[0], docIndex)
+	}
+	if n.Kind != yaml.ScalarNode {
+		return span{}, fmt.Errorf("%s is not a scalar", layers[0])
+	}
+	if len(layers) == 1 {
+		return scalarSpan(data, n)
+	}
+	return embeddedSpan(data, n, layers[1])
+}
+
+// Documents are counted the same way decodeDocs does.
+func documentNode(data []byte, docIndex int) (*yaml.Node, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	idx := 0
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("document %d not found", docIndex)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 || node.Content[0].Tag == "!!null" {
+			continue
+		}
+		if idx == docIndex {
+			return &node, nil
+		}
+		idx++
+	}
+}
+
+func scalarSpan(data []byte, n *yaml.Node) (span, error) {
+	off, err := valueOffset(data, n)
+	if err != nil {
+		return span{}, err
+	}
+	switch {
+	case n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+		return span{}, fmt.Errorf("block scalar at line %d cannot be rewritten in place", n.Line)
+	case n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0:
+		q := byte('"')
+		if n.Style&yaml.SingleQuotedStyle != 0 {
+			q = '\''
+		}
+		end := off + 1 + len(n.Value)
+		if off >= len(data) || data[off] != q || end >= len(data) || data[end] != q || string(data[off+1:end]) != n.Value {
+			return span{}, fmt.Errorf("quoted scalar at line %d contains escapes or could not be located", n.Line)
+		}
+		return span{start: off + 1, end: end, style: n.Style}, nil
+	default:
+		end := off + len(n.Value)
+		if end > len(data) || string(data[off:end]) != n.Value {
+			return span{}, fmt.Errorf("plain scalar at line %d could not be located", n.Line)
+		}
+		return span{start: off, end: end, style: n.Style}, nil
+	}
+}
+
+func valueOffset(data []byte, n *yaml.Node) (int, error) {
+	off, err := offsetOf(data, n.Line, n.Column)
+	if err != nil {
+		return 0, err
+	}
+	for off < len(data) && (data[off] == '&' || data[off] == '!') {
+		for off < len(data) && !isBlank(data[off]) {
+			off++
+		}
+		for off < len(data) && (data[off] == ' ' || data[off] == '\t') {
+			off++
+		}
+	}
+	return off, nil
+}
+
+func offsetOf(data []byte, line, col int) (int, error) {
+	off := 0
+	for l := 1; l < line; l++ {
+		i := bytes.IndexByte(data[off:], '\n')
+		if i < 0 {
+			return 0, fmt.Errorf("line %d is out of range", line)
+		}
+		off += i + 1
+	}
+	for c := 1; c < col; c++ {
+		if off >= len(data) || data[off] == '\n' {
+			return 0, fmt.Errorf("column %d is out of range on line %d", col, line)
+		}
+		_, size := utf8.DecodeRune(data[off:])
+		off += size
+	}
+	return off, nil
+}
+
+func isBlank(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+func embeddedSpan(data []byte, n *yaml.Node, rest string) (span, error) {
+	if n.Style&yaml.LiteralStyle == 0 {
+		return span{}, fmt.Errorf("embedded YAML at line %d is not a literal block scalar", n.Line)
+	}
+	first, err := offsetOf(data, n.Line+1, 1)
+	if err != nil {
+		return span{}, err
+	}
+
+	indent := -1
+	var content strings.Builder
+	var starts []int
+	for off := first; off < len(data); {
+		end := bytes.IndexByte(data[off:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += off
+		}
+		line := data[off:end]
+		if len(bytes.TrimSpace(line)) != 0 {
+			lead := len(line) - len(bytes.TrimLeft(line, " "))
+			if indent < 0 {
+				indent = lead
+			}
+			if lead < indent || indent == 0 {
+				break
+			}
+		}
+		starts = append(starts, off+max(indent, 0))
+		if indent > 0 && len(line) > indent {
+			content.Write(line[indent:])
+		}
+		content.WriteByte('\n')
+		off = end + 1
+	}
+	if indent <= 0 || strings.TrimRight(content.String(), "\n") != strings.TrimRight(n.Value, "\n") {
+		return span{}, fmt.Errorf("literal block at line %d cannot be mapped onto the file", n.Line)
+	}
+
+	value := []byte(n.Value)
+	inner, err := locateValue(value, 0, rest)
+	if err != nil {
+		return span{}, err
+	}
+	k := bytes.Count(value[:inner.start], []byte("\n"))
+	col := inner.start - (bytes.LastIndexByte(value[:inner.start], '\n') + 1)
+	start := starts[k] + col
+	return span{start: start, end: start + inner.end - inner.start, style: inner.style}, nil
+}
+
+func fitsStyle(v string, style yaml.Style) error {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		if strings.ContainsAny(v, "\"\\\n") {
+			return fmt.Errorf("%q cannot be written into a double-quoted scalar", v)
+		}
+	case style&yaml.SingleQuotedStyle != 0:
+		if strings.ContainsAny(v, "'\n") {
+			return fmt.Errorf("%q cannot be written into a single-quoted scalar", v)
+		}
+	default:
+		if !plainSafeRe.MatchString(v) || strings.HasSuffix(v, ":") {
+			return fmt.Errorf("%q cannot be written as a plain scalar", v)
+		}
+	}
+	return nil
+}
+
+func nodeAtPath(n *yaml.Node, parts []string) *yaml.Node {
+	if n.Kind == yaml.DocumentNode {
+		if len(n.Content) == 0 {
+			return nil
+		}
+		n = n.Content[0]
+	}
+	cur := resolveAlias(n)
+	for _, part := range parts {
+		if cur.Kind != yaml.MappingNode {
+			return nil
+		}
+		next := mappingValue(cur, part, 0)
+		if next == nil {
+			return nil
+		}
+		cur = resolveAlias(next)
+	}
+	return cur
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n
+}
+
+func mappingValue(m *yaml.Node, key string, depth int) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Tag != "!!merge" && m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	if depth > maxAliasDepth {
+		return nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Tag != "!!merge" {
+			continue
+		}
+		for _, src := range mergeSources(m.Content[i+1]) {
+			if v := mappingValue(src, key, depth+1); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+func mergeSources(n *yaml.Node) []*yaml.Node {
+	n = resolveAlias(n)
+	var out []*yaml.Node
+	if n.Kind == yaml.MappingNode {
+		return append(out, n)
+	}
+	if n.Kind == yaml.SequenceNode {
+		for _, c := range n.Content {
+			if c = resolveAlias(c); c.Kind == yaml.MappingNode {
+				out = append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+const maxAliasDepth = 32
+
+func anchorDependents(data []byte, docIndex int, p string) []string {
+	if strings.Contains(p, "|") || !bytes.ContainsAny(data, "&*") {
+		return nil
+	}
+	root, err := documentNode(data, docIndex)
+	if err != nil {
+		return nil
+	}
+	target := nodeAtPath(root, splitPath(p))
+	if target == nil || target.Anchor == "" {
+		return nil
+	}
+	var refs []string
+	collectRefs(root.Content[0], "", target, 0, &refs)
+
+	self := canonicalPath(p)
+	var out []string
+	for _, r := range refs {
+		if r != self && !slices.Contains(out, r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func collectRefs(n *yaml.Node, p string, target *yaml.Node, depth int, out *[]string) {
+	if depth > maxAliasDepth {
+		return
+	}
+	if n == target {
+		*out = append(*out, p)
+		return
+	}
+	switch n.Kind {
+	case yaml.AliasNode:
+		if n.Alias != nil {
+			collectRefs(n.Alias, p, target, depth+1, out)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag == "!!merge" {
+				for _, src := range mergeSources(n.Content[i+1]) {
+					collectRefs(src, p, target, depth+1, out)
+				}
+				continue
+			}
+			collectRefs(n.Content[i+1], joinPath(p, n.Content[i].Value), target, depth, out)
+		}
+	case yaml.SequenceNode:
+		for i, c := range n.Content {
+			collectRefs(c, fmt.Sprintf("%s[%d]", p, i), target, depth, out)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cloudauth
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+var acrHost = regexp.MustCompile(`^[a-z0-9]+\.azurecr\.(?:io|cn|us)$`)
+
+type ACR struct {
+	Getenv Getenv
+
+	registryURL string
+}
+
+func (p *ACR) Name() string { return "acr" }
+
+func (p *ACR) Match(host string) bool {
+	if !acrHost.MatchString(host) {
+		return false
+	}
+	return p.Getenv.get("AZURE_CLIENT_ID") != "" && p.Getenv.get("AZURE_TENANT_ID") != "" &&
+		(p.Getenv.get("AZURE_CLIENT_SECRET") != "" || p.Getenv.get("AZURE_FEDERATED_TOKEN_FILE") != "")
+}
+
+func (p *ACR) Credential(ctx context.Context, client *http.Client, host string) (auth.Credential, error) {
+	tenant := p.Getenv.get("AZURE_TENANT_ID")
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {p.Getenv.get("AZURE_CLIENT_ID")},
+		"scope":      {"https://management.azure.com/.default"},
+	}
+	if secret := p.Getenv.get("AZURE_CLIENT_SECRET"); secret != "" {
+		form.Set("client_secret", secret)
+	} else {
+		token, err := os.ReadFile(p.Getenv.get("AZURE_FEDERATED_TOKEN_FILE"))
+		if err != nil {
+			return auth.EmptyCredential, fmt.Errorf("reading federated token: %w", err)
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", strings.TrimSpace(string(token)))
+	}
+
+	authority := strings.TrimSuffix(cmp.Or(p.Getenv.get("AZURE_AUTHORITY_HOST"), "https://login.microsoftonline.com"), "/")
+	var entra struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := postForm(ctx, client, authority+"/"+tenant+"/oauth2/v2.0/token", form, &entra); err != nil {
+		return auth.EmptyCredential, err
+	}
+
+	var exchange struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := postForm(ctx, client, cmp.Or(p.registryURL, "https://"+host)+"/oauth2/exchange", url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"tenant":       {tenant},
+		"access_token": {entra.AccessToken},
+	}, &exchange)
+	if err != nil {
+		return auth.EmptyCredential, err
+	}
+	return auth.Credential{RefreshToken: exchange.RefreshToken}, nil
+}
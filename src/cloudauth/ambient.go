@@ -0,0 +1,210 @@
+package cloudauth
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const metadataTimeout = 2 * time.Second
+
+var errNoCredentials = errors.New("no credentials found")
+
+func ambientAWSKeys(ctx context.Context, client *http.Client, getenv Getenv, stsEndpoint string) (awsKeys, error) {
+	if hasAWSKeys(getenv) {
+		return loadAWSKeys(ctx, client, getenv, stsEndpoint)
+	}
+	if keys, ok, err := profileKeys(getenv); ok || err != nil {
+		return keys, err
+	}
+	if getenv.get("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || getenv.get("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return containerKeys(ctx, client, getenv)
+	}
+	if !strings.EqualFold(getenv.get("AWS_EC2_METADATA_DISABLED"), "true") {
+		if keys, ok, err := instanceKeys(ctx, client, getenv); ok || err != nil {
+			return keys, err
+		}
+	}
+	return awsKeys{}, errNoCredentials
+}
+
+func profileKeys(getenv Getenv) (awsKeys, bool, error) {
+	profile := cmp.Or(getenv.get("AWS_PROFILE"), getenv.get("AWS_DEFAULT_PROFILE"), "default")
+	home := getenv.get("HOME")
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	files := []struct{ path, section string }{
+		{cmp.Or(getenv.get("AWS_SHARED_CREDENTIALS_FILE"), filepath.Join(home, ".aws", "credentials")), profile},
+		{cmp.Or(getenv.get("AWS_CONFIG_FILE"), filepath.Join(home, ".aws", "config")), section},
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return awsKeys{}, false, fmt.Errorf("reading %s: %w", f.path, err)
+		}
+		values := iniSection(data, f.section)
+		if id := values["aws_access_key_id"]; id != "" {
+			return awsKeys{
+				accessKeyID:     id,
+				secretAccessKey: values["aws_secret_access_key"],
+				sessionToken:    values["aws_session_token"],
+			}, true, nil
+		}
+	}
+	if getenv.get("AWS_PROFILE") != "" {
+		return awsKeys{}, false, fmt.Errorf("AWS profile %q has no aws_access_key_id (profiles assuming a role or using SSO are not supported)", profile)
+	}
+	return awsKeys{}, false, nil
+}
+
+func iniSection(data []byte, name string) map[string]string {
+	values := map[string]string{}
+	in := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			in = strings.TrimSpace(line[1:len(line)-1]) == name
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); in && ok {
+			values[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+type metadataKeys struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+func (k metadataKeys) keys() awsKeys {
+	return awsKeys{accessKeyID: k.AccessKeyID, secretAccessKey: k.SecretAccessKey, sessionToken: k.Token}
+}
+
+func containerKeys(ctx context.Context, client *http.Client, getenv Getenv) (awsKeys, error) {
+	endpoint := getenv.get("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := getenv.get("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsKeys{}, err
+	}
+	token := getenv.get("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if file := getenv.get("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return awsKeys{}, fmt.Errorf("reading container authorization token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	var out metadataKeys
+	if err := doJSON(client, req, &out); err != nil {
+		return awsKeys{}, fmt.Errorf("container credentials: %w", err)
+	}
+	return out.keys(), nil
+}
+
+func instanceKeys(ctx context.Context, client *http.Client, getenv Getenv) (awsKeys, bool, error) {
+	endpoint := strings.TrimSuffix(cmp.Or(getenv.get("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "http://169.254.169.254"), "/")
+	probe, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+
+	token, status, err := metadataRequest(probe, client, http.MethodPut, endpoint+"/latest/api/token",
+		map[string]string{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": "300"})
+	if err != nil || status != http.StatusOK {
+		return awsKeys{}, false, ctx.Err()
+	}
+	header := map[string]string{"X-Aws-Ec2-Metadata-Token": string(token)}
+	roles, status, err := metadataRequest(probe, client, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/", header)
+	if err != nil {
+		return awsKeys{}, false, fmt.Errorf("instance metadata: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	if status == http.StatusNotFound || role == "" {
+		return awsKeys{}, false, nil
+	}
+	if status != http.StatusOK {
+		return awsKeys{}, false, fmt.Errorf("instance metadata: listing roles failed with status code %d", status)
+	}
+	data, status, err := metadataRequest(probe, client, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/"+role, header)
+	if err != nil {
+		return awsKeys{}, false, fmt.Errorf("instance metadata: %w", err)
+	}
+	if status != http.StatusOK {
+		return awsKeys{}, false, fmt.Errorf("instance metadata: credentials of role %s failed with status code %d", role, status)
+	}
+	var out metadataKeys
+	if err := json.Unmarshal(data, &out); err != nil {
+		return awsKeys{}, false, fmt.Errorf("decoding instance credentials: %w", err)
+	}
+	return out.keys(), true, nil
+}
+
+func gceToken(ctx context.Context, client *http.Client, getenv Getenv) (string, bool, error) {
+	host := cmp.Or(getenv.get("GCE_METADATA_HOST"), "metadata.google.internal")
+	probe, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+
+	data, status, err := metadataRequest(probe, client, http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token",
+		map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil || status == http.StatusNotFound {
+		return "", false, ctx.Err()
+	}
+	if status != http.StatusOK {
+		return "", false, fmt.Errorf("metadata server token request failed with status code %d", status)
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", false, fmt.Errorf("decoding metadata server token: %w", err)
+	}
+	return out.AccessToken, true, nil
+}
+
+func metadataRequest(ctx context.Context, client *http.Client, method, url string, header map[string]string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return data, resp.StatusCode, err
+}
@@ -0,0 +1,127 @@
+package cloudauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmbientAWSKeys(t *testing.T) {
+	credentials := writeFile(t, "credentials", "[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = secret\n\n[ci]\naws_access_key_id=AKIDCI\naws_secret_access_key=secret\naws_session_token=session\n")
+	config := writeFile(t, "config", "[profile from-config]\naws_access_key_id = AKIDCONFIG\naws_secret_access_key = secret\n[profile sso]\nsso_start_url = https://example.awsapps.com/start\n")
+	authToken := writeFile(t, "token", "container-token\n")
+
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/task-credentials":
+			if r.Header.Get("Authorization") != "container-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"AccessKeyId":"AKIDTASK","SecretAccessKey":"secret","Token":"task"}`)
+		case r.Method == http.MethodPut && r.URL.Path == "/latest/api/token":
+			assert.Equal(t, "300", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+			fmt.Fprint(w, "imds-token")
+		case r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "instance-role\n")
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/instance-role":
+			fmt.Fprint(w, `{"Code":"Success","AccessKeyId":"AKIDINSTANCE","SecretAccessKey":"secret","Token":"instance"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer metadata.Close()
+	// A server without an instance role.
+	noRole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			fmt.Fprint(w, "imds-token")
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer noRole.Close()
+
+	base := map[string]string{
+		"HOME":                        t.TempDir(),
+		"AWS_SHARED_CREDENTIALS_FILE": credentials,
+		"AWS_CONFIG_FILE":             config,
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr string
+	}{
+		{name: "environment", env: map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "secret"}, want: "AKIDENV"},
+		{name: "default profile", want: "AKIDDEFAULT"},
+		{name: "named profile", env: map[string]string{"AWS_PROFILE": "ci"}, want: "AKIDCI"},
+		{name: "profile of the config file", env: map[string]string{"AWS_PROFILE": "from-config"}, want: "AKIDCONFIG"},
+		{name: "profile without keys", env: map[string]string{"AWS_PROFILE": "sso"}, wantErr: `AWS profile "sso" has no aws_access_key_id`},
+		{name: "container", env: map[string]string{
+			"AWS_SHARED_CREDENTIALS_FILE":            "/nonexistent",
+			"AWS_CONTAINER_CREDENTIALS_FULL_URI":     metadata.URL + "/task-credentials",
+			"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE": authToken,
+		}, want: "AKIDTASK"},
+		{name: "instance", env: map[string]string{
+			"AWS_SHARED_CREDENTIALS_FILE":       "/nonexistent",
+			"AWS_EC2_METADATA_DISABLED":         "",
+			"AWS_EC2_METADATA_SERVICE_ENDPOINT": metadata.URL,
+		}, want: "AKIDINSTANCE"},
+		{name: "instance without role", env: map[string]string{
+			"AWS_SHARED_CREDENTIALS_FILE":       "/nonexistent",
+			"AWS_EC2_METADATA_DISABLED":         "",
+			"AWS_EC2_METADATA_SERVICE_ENDPOINT": noRole.URL,
+		}, wantErr: errNoCredentials.Error()},
+		{name: "none", env: map[string]string{"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent"}, wantErr: errNoCredentials.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			for k, v := range base {
+				env[k] = v
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			keys, err := ambientAWSKeys(context.Background(), http.DefaultClient, envOf(env), "http://sts.invalid")
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, keys.accessKeyID)
+			assert.Equal(t, "secret", keys.secretAccessKey)
+		})
+	}
+}
+
+func TestGCEToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/computeMetadata/v1/instance/service-accounts/default/token", r.URL.Path)
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"ya29.metadata","expires_in":3599,"token_type":"Bearer"}`)
+	}))
+	defer server.Close()
+
+	token, ok, err := gceToken(context.Background(), http.DefaultClient, envOf(map[string]string{"GCE_METADATA_HOST": strings.TrimPrefix(server.URL, "http://")}))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "ya29.metadata", token)
+
+	server.Close()
+	_, ok, err = gceToken(context.Background(), http.DefaultClient, envOf(map[string]string{"GCE_METADATA_HOST": strings.TrimPrefix(server.URL, "http://")}))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
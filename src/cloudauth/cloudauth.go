@@ -0,0 +1,110 @@
+package cloudauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+type Provider interface {
+	Name() string
+	Match(host string) bool
+	Credential(ctx context.Context, client *http.Client, host string) (auth.Credential, error)
+}
+
+type Getenv func(name string) string
+
+func (g Getenv) get(name string) string {
+	if g == nil {
+		return os.Getenv(name)
+	}
+	return g(name)
+}
+
+type Resolver struct {
+	Providers []Provider
+	Client    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]*cachedCredential
+}
+
+type cachedCredential struct {
+	mu   sync.Mutex
+	cred *auth.Credential
+}
+
+func NewResolver(client *http.Client, getenv Getenv) *Resolver {
+	return &Resolver{Providers: []Provider{&ECR{Getenv: getenv}, &GAR{Getenv: getenv}, &ACR{Getenv: getenv}}, Client: client}
+}
+
+func (r *Resolver) For(host string) (Provider, auth.CredentialFunc) {
+	for _, p := range r.Providers {
+		if p.Match(host) {
+			return p, func(ctx context.Context, _ string) (auth.Credential, error) {
+				return r.credential(ctx, p, host)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (r *Resolver) credential(ctx context.Context, p Provider, host string) (auth.Credential, error) {
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = map[string]*cachedCredential{}
+	}
+	c, ok := r.cache[host]
+	if !ok {
+		c = &cachedCredential{}
+		r.cache[host] = c
+	}
+	r.mu.Unlock()
+
+	// Concurrent callers wait for a single exchange.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cred != nil {
+		return *c.cred, nil
+	}
+	cred, err := p.Credential(ctx, r.Client, host)
+	if err != nil {
+		return auth.EmptyCredential, fmt.Errorf("%s credentials for %s: %w", p.Name(), host, err)
+	}
+	c.cred = &cred
+	return cred, nil
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s %s failed with status code %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+func postForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return doJSON(client, req, out)
+}
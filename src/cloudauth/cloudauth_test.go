@@ -0,0 +1,293 @@
+package cloudauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+func envOf(vars map[string]string) Getenv {
+	return func(name string) string { return vars[name] }
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(p, []byte(content), 0600))
+	return p
+}
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla from the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	keys := awsKeys{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, keys, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestSignV4_Query(t *testing.T) {
+	// get-vanilla-query-unreserved from the AWS Signature Version 4 test suite.
+	unreserved := "-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/?"+unreserved+"="+unreserved, nil)
+	keys := awsKeys{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, keys, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197", req.Header.Get("Authorization"))
+
+	assert.Equal(t, "a%20b=c%2Bd%2Fe&a%20b=x~y&k=", canonicalQuery(url.Values{"a b": {"x~y", "c+d/e"}, "k": {""}}))
+}
+
+func TestResolver_For(t *testing.T) {
+	env := map[string]string{}
+	r := NewResolver(http.DefaultClient, envOf(env))
+
+	p, credential := r.For("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.Nil(t, p)
+	assert.Nil(t, credential)
+
+	env["AWS_ACCESS_KEY_ID"] = "AKID"
+	env["GOOGLE_OAUTH_ACCESS_TOKEN"] = "ya29"
+	env["AZURE_CLIENT_ID"] = "client"
+	env["AZURE_TENANT_ID"] = "tenant"
+	env["AZURE_CLIENT_SECRET"] = "secret"
+
+	for host, name := range map[string]string{
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com":     "ecr",
+		"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn": "ecr",
+		"europe-west1-docker.pkg.dev":                      "gar",
+		"eu.gcr.io":                                        "gar",
+		"myregistry.azurecr.io":                            "acr",
+	} {
+		p, credential := r.For(host)
+		if assert.NotNil(t, p, host) {
+			assert.Equal(t, name, p.Name())
+			assert.NotNil(t, credential)
+		}
+	}
+
+	p, _ = r.For("ghcr.io")
+	assert.Nil(t, p)
+}
+
+func TestResolver_ExchangesOncePerHost(t *testing.T) {
+	r := NewResolver(http.DefaultClient, nil)
+
+	var calls atomic.Int32
+	r.Providers = []Provider{countingProvider{Provider: &GAR{Getenv: envOf(map[string]string{"GOOGLE_OAUTH_ACCESS_TOKEN": "ya29"})}, calls: &calls}}
+	_, credential := r.For("europe-west1-docker.pkg.dev")
+	for range 3 {
+		cred, err := credential(context.Background(), "europe-west1-docker.pkg.dev")
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Credential{Username: "oauth2accesstoken", Password: "ya29"}, cred)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestResolver_RetriesFailedExchange(t *testing.T) {
+	env := map[string]string{"AWS_ACCESS_KEY_ID": "AKID"}
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, `{"__type":"ThrottlingException"}`, http.StatusBadRequest)
+			return
+		}
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:registry-password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q}]}`, token)
+	}))
+	defer api.Close()
+
+	r := NewResolver(http.DefaultClient, nil)
+	r.Providers = []Provider{&ECR{Getenv: envOf(env), apiURL: api.URL}}
+	host := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	_, credential := r.For(host)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := credential(ctx, host)
+	assert.Error(t, err)
+	_, err = credential(context.Background(), host)
+	assert.ErrorContains(t, err, "ThrottlingException")
+	for range 2 {
+		cred, err := credential(context.Background(), host)
+		assert.NoError(t, err)
+		assert.Equal(t, auth.Credential{Username: "AWS", Password: "registry-password"}, cred)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+type countingProvider struct {
+	Provider
+	calls *atomic.Int32
+}
+
+func (p countingProvider) Credential(ctx context.Context, client *http.Client, host string) (auth.Credential, error) {
+	p.calls.Add(1)
+	return p.Provider.Credential(ctx, client, host)
+}
+
+func TestECR_WebIdentity(t *testing.T) {
+	env := envOf(map[string]string{
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/charts",
+		"AWS_WEB_IDENTITY_TOKEN_FILE": writeFile(t, "token", "oidc-token\n"),
+	})
+
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "AssumeRoleWithWebIdentity", r.Form.Get("Action"))
+		assert.Equal(t, "oidc-token", r.Form.Get("WebIdentityToken"))
+		assert.Equal(t, "arn:aws:iam::123456789012:role/charts", r.Form.Get("RoleArn"))
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>
+</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer sts.Close()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "session", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIA/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/ecr/aws4_request")
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:registry-password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q}]}`, token)
+	}))
+	defer api.Close()
+
+	p := &ECR{Getenv: env, stsURL: sts.URL, apiURL: api.URL}
+	host := "123456789012.dkr.ecr.eu-west-1.amazonaws.com"
+	assert.True(t, p.Match(host))
+	cred, err := p.Credential(context.Background(), http.DefaultClient, host)
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Credential{Username: "AWS", Password: "registry-password"}, cred)
+}
+
+func TestGAR_ServiceAccount(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.Form.Get("grant_type"))
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		require.Len(t, parts, 3)
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig))
+		claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.Contains(t, string(claims), `"iss":"charts@project.iam.gserviceaccount.com"`)
+		fmt.Fprint(w, `{"access_token":"ya29.sa","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	creds, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "charts@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	p := &GAR{Getenv: envOf(map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": writeFile(t, "sa.json", string(creds))})}
+
+	cred, err := p.Credential(context.Background(), http.DefaultClient, "europe-west1-docker.pkg.dev")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Credential{Username: "oauth2accesstoken", Password: "ya29.sa"}, cred)
+}
+
+func TestGAR_ExternalAccount(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oidc", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer request-token", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"value":"github-oidc"}`)
+	})
+	mux.HandleFunc("/sts", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "github-oidc", r.Form.Get("subject_token"))
+		assert.Equal(t, "//iam.googleapis.com/pool", r.Form.Get("audience"))
+		fmt.Fprint(w, `{"access_token":"federated"}`)
+	})
+	mux.HandleFunc("/impersonate", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer federated", r.Header.Get("Authorization"))
+		fmt.Fprint(w, `{"accessToken":"ya29.impersonated"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	creds := fmt.Sprintf(`{
+  "type": "external_account",
+  "audience": "//iam.googleapis.com/pool",
+  "subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+  "token_url": %q,
+  "service_account_impersonation_url": %q,
+  "credential_source": {
+    "url": %q,
+    "headers": {"Authorization": "Bearer request-token"},
+    "format": {"type": "json", "subject_token_field_name": "value"}
+  }
+}`, server.URL+"/sts", server.URL+"/impersonate", server.URL+"/oidc")
+	p := &GAR{Getenv: envOf(map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": writeFile(t, "wif.json", creds)})}
+
+	cred, err := p.Credential(context.Background(), http.DefaultClient, "europe-west1-docker.pkg.dev")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Credential{Username: "oauth2accesstoken", Password: "ya29.impersonated"}, cred)
+}
+
+func TestACR_FederatedToken(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client", r.Form.Get("client_id"))
+		assert.Equal(t, "federated", r.Form.Get("client_assertion"))
+		fmt.Fprint(w, `{"access_token":"entra"}`)
+	})
+	mux.HandleFunc("/oauth2/exchange", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "entra", r.Form.Get("access_token"))
+		assert.Equal(t, "myregistry.azurecr.io", r.Form.Get("service"))
+		fmt.Fprint(w, `{"refresh_token":"acr-refresh"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	p := &ACR{registryURL: server.URL, Getenv: envOf(map[string]string{
+		"AZURE_CLIENT_ID":            "client",
+		"AZURE_TENANT_ID":            "tenant",
+		"AZURE_FEDERATED_TOKEN_FILE": writeFile(t, "token", "federated"),
+		"AZURE_AUTHORITY_HOST":       server.URL + "/",
+	})}
+	assert.True(t, p.Match("myregistry.azurecr.io"))
+	cred, err := p.Credential(context.Background(), http.DefaultClient, "myregistry.azurecr.io")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Credential{RefreshToken: "acr-refresh"}, cred)
+}
+
+func TestECR_ErrorStatus(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"__type":"AccessDeniedException"}`, http.StatusBadRequest)
+	}))
+	defer api.Close()
+
+	r := NewResolver(http.DefaultClient, nil)
+	r.Providers = []Provider{&ECR{Getenv: envOf(map[string]string{"AWS_ACCESS_KEY_ID": "AKID"}), apiURL: api.URL}}
+	_, credential := r.For("123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	_, err := credential(context.Background(), "123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.ErrorContains(t, err, "ecr credentials for 123456789012.dkr.ecr.eu-west-1.amazonaws.com")
+	assert.ErrorContains(t, err, "AccessDeniedException")
+}
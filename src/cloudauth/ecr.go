@@ -0,0 +1,230 @@
+package cloudauth
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+var ecrHost = regexp.MustCompile(`^\d{12}\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+type ECR struct {
+	Getenv Getenv
+
+	stsURL string
+	apiURL string
+}
+
+type awsKeys struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+func (p *ECR) Name() string { return "ecr" }
+
+func (p *ECR) Match(host string) bool {
+	return ecrHost.MatchString(host) && hasAWSKeys(p.Getenv)
+}
+
+func (p *ECR) Credential(ctx context.Context, client *http.Client, host string) (auth.Credential, error) {
+	m := ecrHost.FindStringSubmatch(host)
+	if m == nil {
+		return auth.EmptyCredential, fmt.Errorf("%s is not an ECR registry", host)
+	}
+	region, domain := m[1], "amazonaws.com"+m[2]
+
+	keys, err := p.keys(ctx, client, region, domain)
+	if err != nil {
+		return auth.EmptyCredential, err
+	}
+
+	body := []byte("{}")
+	endpoint := cmp.Or(p.apiURL, "https://api.ecr."+region+"."+domain) + "/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return auth.EmptyCredential, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signV4(req, body, keys, region, "ecr", time.Now())
+
+	var out struct {
+		AuthorizationData []struct {
+			AuthorizationToken string `json:"authorizationToken"`
+		} `json:"authorizationData"`
+	}
+	if err := doJSON(client, req, &out); err != nil {
+		return auth.EmptyCredential, err
+	}
+	if len(out.AuthorizationData) == 0 {
+		return auth.EmptyCredential, fmt.Errorf("GetAuthorizationToken returned no token")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(out.AuthorizationData[0].AuthorizationToken)
+	if err != nil {
+		return auth.EmptyCredential, fmt.Errorf("decoding authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return auth.EmptyCredential, fmt.Errorf("authorization token is not username:password")
+	}
+	return auth.Credential{Username: username, Password: password}, nil
+}
+
+func (p *ECR) keys(ctx context.Context, client *http.Client, region, domain string) (awsKeys, error) {
+	return loadAWSKeys(ctx, client, p.Getenv, cmp.Or(p.stsURL, "https://sts."+region+"."+domain))
+}
+
+func hasAWSKeys(getenv Getenv) bool {
+	return getenv.get("AWS_ACCESS_KEY_ID") != "" ||
+		(getenv.get("AWS_ROLE_ARN") != "" && getenv.get("AWS_WEB_IDENTITY_TOKEN_FILE") != "")
+}
+
+func loadAWSKeys(ctx context.Context, client *http.Client, getenv Getenv, stsEndpoint string) (awsKeys, error) {
+	if id := getenv.get("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsKeys{
+			accessKeyID:     id,
+			secretAccessKey: getenv.get("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    getenv.get("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	tokenFile := getenv.get("AWS_WEB_IDENTITY_TOKEN_FILE")
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsKeys{}, fmt.Errorf("reading web identity token: %w", err)
+	}
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {getenv.get("AWS_ROLE_ARN")},
+		"RoleSessionName":  {cmp.Or(getenv.get("AWS_ROLE_SESSION_NAME"), "argocd-apps-action")},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, stsEndpoint+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsKeys{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsKeys{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return awsKeys{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsKeys{}, fmt.Errorf("AssumeRoleWithWebIdentity failed with status code %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &out); err != nil {
+		return awsKeys{}, fmt.Errorf("decoding AssumeRoleWithWebIdentity response: %w", err)
+	}
+	return awsKeys{
+		accessKeyID:     out.Credentials.AccessKeyID,
+		secretAccessKey: out.Credentials.SecretAccessKey,
+		sessionToken:    out.Credentials.SessionToken,
+	}, nil
+}
+
+func signV4(req *http.Request, body []byte, keys awsKeys, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if keys.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", keys.sessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	slices.Sort(names)
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.Host
+		if value == "" {
+			value = req.URL.Host
+		}
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{req.Method, path, canonicalQuery(req.URL.Query()), headers.String(), signed, sha256Hex(body)}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := []byte("AWS4" + keys.secretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keys.accessKeyID, scope, signed, signature))
+}
+
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,217 @@
+package cloudauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+const googleScope = "https://www.googleapis.com/auth/cloud-platform"
+
+type GAR struct {
+	Getenv Getenv
+}
+
+type googleCredentials struct {
+	Type string `json:"type"`
+
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	TokenURL                       string `json:"token_url"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		File    string            `json:"file"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Format  struct {
+			Type                  string `json:"type"`
+			SubjectTokenFieldName string `json:"subject_token_field_name"`
+		} `json:"format"`
+	} `json:"credential_source"`
+}
+
+func (p *GAR) Name() string { return "gar" }
+
+func (p *GAR) Match(host string) bool {
+	if !strings.HasSuffix(host, "-docker.pkg.dev") && host != "gcr.io" && !strings.HasSuffix(host, ".gcr.io") {
+		return false
+	}
+	return p.Getenv.get("GOOGLE_OAUTH_ACCESS_TOKEN") != "" || p.Getenv.get("GOOGLE_APPLICATION_CREDENTIALS") != ""
+}
+
+func (p *GAR) Credential(ctx context.Context, client *http.Client, host string) (auth.Credential, error) {
+	token, err := p.accessToken(ctx, client)
+	if err != nil {
+		return auth.EmptyCredential, err
+	}
+	return auth.Credential{Username: "oauth2accesstoken", Password: token}, nil
+}
+
+func (p *GAR) accessToken(ctx context.Context, client *http.Client) (string, error) {
+	if token := p.Getenv.get("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	data, err := os.ReadFile(p.Getenv.get("GOOGLE_APPLICATION_CREDENTIALS"))
+	if err != nil {
+		return "", err
+	}
+	var creds googleCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("decoding GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	switch creds.Type {
+	case "service_account":
+		return serviceAccountToken(ctx, client, creds)
+	case "external_account":
+		return externalAccountToken(ctx, client, creds)
+	default:
+		return "", fmt.Errorf("unsupported credentials type %q, expected service_account or external_account", creds.Type)
+	}
+}
+
+func serviceAccountToken(ctx context.Context, client *http.Client, creds googleCredentials) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("service account private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("parsing service account private key: %w", err)
+		}
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("service account private key is not RSA")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   creds.ClientEmail,
+		"scope": googleScope,
+		"aud":   creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = postForm(ctx, client, creds.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	}, &out)
+	return out.AccessToken, err
+}
+
+func externalAccountToken(ctx context.Context, client *http.Client, creds googleCredentials) (string, error) {
+	subject, err := subjectToken(ctx, client, creds)
+	if err != nil {
+		return "", err
+	}
+
+	var sts struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = postForm(ctx, client, creds.TokenURL, url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {creds.Audience},
+		"scope":                {googleScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subject},
+		"subject_token_type":   {creds.SubjectTokenType},
+	}, &sts)
+	if err != nil {
+		return "", err
+	}
+	if creds.ServiceAccountImpersonationURL == "" {
+		return sts.AccessToken, nil
+	}
+
+	body, _ := json.Marshal(map[string]any{"scope": []string{googleScope}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.ServiceAccountImpersonationURL, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+sts.AccessToken)
+	var impersonated struct {
+		AccessToken string `json:"accessToken"`
+	}
+	err = doJSON(client, req, &impersonated)
+	return impersonated.AccessToken, err
+}
+
+func subjectToken(ctx context.Context, client *http.Client, creds googleCredentials) (string, error) {
+	src := creds.CredentialSource
+	var data []byte
+	switch {
+	case src.File != "":
+		var err error
+		if data, err = os.ReadFile(src.File); err != nil {
+			return "", err
+		}
+	case src.URL != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+		if err != nil {
+			return "", err
+		}
+		for name, value := range src.Headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("subject token request failed with status code %d", resp.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("credential_source has neither file nor url")
+	}
+
+	if src.Format.Type != "json" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return "", fmt.Errorf("decoding subject token: %w", err)
+	}
+	token, ok := fields[src.Format.SubjectTokenFieldName].(string)
+	if !ok {
+		return "", fmt.Errorf("subject token has no string field %q", src.Format.SubjectTokenFieldName)
+	}
+	return token, nil
+}
@@ -0,0 +1,201 @@
+package cloudauth
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type S3 struct {
+	Client *http.Client
+	Getenv Getenv
+
+	mu      sync.Mutex
+	loaded  bool
+	keys    *awsKeys
+	regions map[string]string
+}
+
+func (s *S3) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	keys, err := s.credentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3 credentials: %w", err)
+	}
+	region := s.region(bucket)
+	rc, err := s.get(ctx, bucket, key, region, keys)
+	var status *objectStatusError
+	if errors.As(err, &status) && (status.statusCode == http.StatusMovedPermanently || status.statusCode == http.StatusBadRequest) {
+		// A bucket of another region names its region in the error response.
+		if moved := status.header.Get("X-Amz-Bucket-Region"); moved != "" && moved != region {
+			s.mu.Lock()
+			if s.regions == nil {
+				s.regions = map[string]string{}
+			}
+			s.regions[bucket] = moved
+			s.mu.Unlock()
+			rc, err = s.get(ctx, bucket, key, moved, keys)
+		}
+	}
+	if keys == nil && errors.As(err, &status) && (status.statusCode == http.StatusUnauthorized || status.statusCode == http.StatusForbidden) {
+		return nil, fmt.Errorf("%w (no AWS credentials were found in the environment, the shared credentials files or the container and instance metadata, so the request was anonymous)", err)
+	}
+	return rc, err
+}
+
+func (s *S3) get(ctx context.Context, bucket, key, region string, keys *awsKeys) (io.ReadCloser, error) {
+	endpoint := "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escapeKey(key)
+	if custom := s.endpoint(); custom != "" {
+		endpoint = strings.TrimSuffix(custom, "/") + "/" + bucket + "/" + escapeKey(key)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		req.Header.Set("X-Amz-Content-Sha256", sha256Hex(nil))
+		signV4(req, nil, *keys, region, "s3", time.Now())
+	}
+	return openObject(client(s.Client), req)
+}
+
+func (s *S3) endpoint() string {
+	return cmp.Or(s.Getenv.get("AWS_ENDPOINT_URL_S3"), s.Getenv.get("AWS_ENDPOINT_URL"))
+}
+
+func (s *S3) region(bucket string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return cmp.Or(s.regions[bucket], s.Getenv.get("AWS_REGION"), s.Getenv.get("AWS_DEFAULT_REGION"), "us-east-1")
+}
+
+func (s *S3) credentials(ctx context.Context) (*awsKeys, error) {
+	region := s.region("")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loaded {
+		return s.keys, nil
+	}
+	sts := cmp.Or(s.Getenv.get("AWS_ENDPOINT_URL_STS"), "https://sts."+region+".amazonaws.com")
+	keys, err := ambientAWSKeys(ctx, client(s.Client), s.Getenv, strings.TrimSuffix(sts, "/"))
+	switch {
+	case errors.Is(err, errNoCredentials):
+	case err != nil:
+		return nil, err
+	default:
+		s.keys = &keys
+	}
+	s.loaded = true
+	return s.keys, nil
+}
+
+type GCS struct {
+	Client *http.Client
+	Getenv Getenv
+
+	mu     sync.Mutex
+	loaded bool
+	token  string
+}
+
+func (g *GCS) Get(ctx context.Context, bucket, object string) (io.ReadCloser, error) {
+	token, err := g.accessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcs credentials: %w", err)
+	}
+	endpoint := "https://storage.googleapis.com"
+	if host := g.Getenv.get("STORAGE_EMULATOR_HOST"); host != "" {
+		endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		endpoint+"/storage/v1/b/"+url.PathEscape(bucket)+"/o/"+url.PathEscape(object)+"?alt=media", nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rc, err := openObject(client(g.Client), req)
+	var status *objectStatusError
+	if token == "" && errors.As(err, &status) && (status.statusCode == http.StatusUnauthorized || status.statusCode == http.StatusForbidden) {
+		return nil, fmt.Errorf("%w (no Google credentials were found in GOOGLE_OAUTH_ACCESS_TOKEN, GOOGLE_APPLICATION_CREDENTIALS or the metadata server, so the request was anonymous)", err)
+	}
+	return rc, err
+}
+
+func (g *GCS) accessToken(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.loaded {
+		return g.token, nil
+	}
+	switch {
+	case g.Getenv.get("GOOGLE_OAUTH_ACCESS_TOKEN") != "" || g.Getenv.get("GOOGLE_APPLICATION_CREDENTIALS") != "":
+		token, err := (&GAR{Getenv: g.Getenv}).accessToken(ctx, client(g.Client))
+		if err != nil {
+			return "", err
+		}
+		g.token = token
+	case g.Getenv.get("STORAGE_EMULATOR_HOST") == "":
+		token, _, err := gceToken(ctx, client(g.Client), g.Getenv)
+		if err != nil {
+			return "", err
+		}
+		g.token = token
+	}
+	g.loaded = true
+	return g.token, nil
+}
+
+func client(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+type objectStatusError struct {
+	url        string
+	statusCode int
+	header     http.Header
+	body       string
+}
+
+func (e *objectStatusError) Error() string {
+	return fmt.Sprintf("GET %s failed with status code %d: %s", e.url, e.statusCode, e.body)
+}
+
+func openObject(c *http.Client, req *http.Request) (io.ReadCloser, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, &objectStatusError{
+			url:        req.URL.Redacted(),
+			statusCode: resp.StatusCode,
+			header:     resp.Header,
+			body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return resp.Body, nil
+}
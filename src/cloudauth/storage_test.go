@@ -0,0 +1,103 @@
+package cloudauth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/charts-bucket/stable/index.yaml", r.URL.Path)
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "<Error><Code>AccessDenied</Code></Error>")
+			return
+		}
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-central-1/s3/aws4_request")
+		assert.Equal(t, sha256Hex(nil), r.Header.Get("X-Amz-Content-Sha256"))
+		fmt.Fprint(w, "entries: {}\n")
+	}))
+	defer server.Close()
+	env := map[string]string{
+		"AWS_ENDPOINT_URL_S3":       server.URL,
+		"AWS_REGION":                "eu-central-1",
+		"AWS_EC2_METADATA_DISABLED": "true",
+		"HOME":                      t.TempDir(),
+	}
+
+	_, err := (&S3{Getenv: envOf(env)}).Get(context.Background(), "charts-bucket", "stable/index.yaml")
+	assert.ErrorContains(t, err, "status code 403")
+	assert.ErrorContains(t, err, "no AWS credentials were found")
+
+	env["AWS_ACCESS_KEY_ID"] = "AKID"
+	env["AWS_SECRET_ACCESS_KEY"] = "secret"
+	rc, err := (&S3{Getenv: envOf(env)}).Get(context.Background(), "charts-bucket", "stable/index.yaml")
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "entries: {}\n", string(data))
+}
+
+func TestS3_Get_RegionRedirect(t *testing.T) {
+	var regions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		region := strings.Split(r.Header.Get("Authorization"), "/")[2]
+		regions = append(regions, region)
+		if region != "ap-southeast-2" {
+			w.Header().Set("X-Amz-Bucket-Region", "ap-southeast-2")
+			w.WriteHeader(http.StatusMovedPermanently)
+			fmt.Fprint(w, "<Error><Code>PermanentRedirect</Code></Error>")
+			return
+		}
+		fmt.Fprint(w, "entries: {}\n")
+	}))
+	defer server.Close()
+	s := &S3{Getenv: envOf(map[string]string{
+		"AWS_ENDPOINT_URL_S3":   server.URL,
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	})}
+
+	for range 2 {
+		rc, err := s.Get(context.Background(), "charts-bucket", "index.yaml")
+		require.NoError(t, err)
+		rc.Close()
+	}
+	assert.Equal(t, []string{"us-east-1", "ap-southeast-2", "ap-southeast-2"}, regions)
+}
+
+func TestGCS_Get(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/storage/v1/b/charts-bucket/o/stable%2Findex.yaml", r.URL.EscapedPath())
+		assert.Equal(t, "media", r.URL.Query().Get("alt"))
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "Bearer ya29.token", r.Header.Get("Authorization"))
+		fmt.Fprint(w, "entries: {}\n")
+	}))
+	defer server.Close()
+	env := map[string]string{"STORAGE_EMULATOR_HOST": strings.TrimPrefix(server.URL, "http://")}
+
+	_, err := (&GCS{Getenv: envOf(env)}).Get(context.Background(), "charts-bucket", "stable/index.yaml")
+	assert.ErrorContains(t, err, "no Google credentials were found")
+
+	env["GOOGLE_OAUTH_ACCESS_TOKEN"] = "ya29.token"
+	rc, err := (&GCS{Getenv: envOf(env)}).Get(context.Background(), "charts-bucket", "stable/index.yaml")
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "entries: {}\n", string(data))
+}
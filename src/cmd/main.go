@@ -2,27 +2,61 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/ironashram/argocd-apps-action/argoaction"
 	"github.com/ironashram/argocd-apps-action/config"
 	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
 )
 
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	action := internal.NewGithubActionInterface()
+	run(ctx, internal.NewGithubActionInterface(), &internal.OSWrapper{}, os.Args[1:])
+}
+
+func run(ctx context.Context, action internal.ActionInterface, osi internal.OSInterface, args []string) {
+	if len(args) > 0 && args[0] == "snapshot" {
+		cfg, err := config.NewSnapshotFromInputs(action, osi)
+		if err != nil {
+			action.Fatalf("Error parsing inputs: %v", err)
+		}
+		out := "versions-snapshot.json"
+		if len(args) > 1 {
+			out = args[1]
+		}
+		writeSnapshot(ctx, cfg, action, out)
+		return
+	}
 
-	cfg, err := config.NewFromInputs(action)
+	cfg, err := config.NewFromInputs(action, osi)
 	if err != nil {
 		action.Fatalf("Error parsing inputs: %v", err)
 	}
-
 	err = argoaction.StartUpdate(ctx, cfg, action)
 	if err != nil {
 		action.Fatalf("Error starting action: %v", err)
 	}
 }
+
+func writeSnapshot(ctx context.Context, cfg *models.Config, action internal.ActionInterface, out string) {
+	snapshot, err := argoaction.BuildSnapshot(ctx, cfg, action)
+	if snapshot != nil {
+		data, merr := json.MarshalIndent(snapshot, "", "  ")
+		if merr != nil {
+			action.Fatalf("Error encoding versions snapshot: %v", merr)
+		}
+		if werr := os.WriteFile(out, append(data, '\n'), 0o644); werr != nil {
+			action.Fatalf("Error writing versions snapshot: %v", werr)
+		}
+		action.Infof("Wrote the versions of %d chart(s) to %s", len(snapshot.Charts), out)
+	}
+	if err != nil {
+		action.Fatalf("Error building versions snapshot: %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ironashram/argocd-apps-action/internal"
+	"github.com/ironashram/argocd-apps-action/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_Snapshot(t *testing.T) {
+	workspace := t.TempDir()
+	write := func(name, content string) {
+		p := filepath.Join(workspace, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	write("apps/app.yaml", `apiVersion: argoproj.io/v1alpha1
+kind: Application
+spec:
+  source:
+    repoURL: file://charts
+    chart: app
+    targetRevision: 1.0.0
+`)
+	write("charts/index.yaml", "entries:\n  app:\n  - version: 1.1.0\n  - version: 1.0.0\n")
+
+	// Only the variables of the README example are set.
+	for _, name := range []string{"GITHUB_REPOSITORY", "GITHUB_TOKEN", "INPUT_CREATE_PR", "INPUT_SKIP_PRERELEASE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("GITHUB_WORKSPACE", workspace)
+	t.Setenv("INPUT_APPS_FOLDER", "apps")
+	t.Setenv("INPUT_FILE_EXTENSIONS", "yaml,yml")
+
+	out := filepath.Join(t.TempDir(), "versions-snapshot.json")
+	run(context.Background(), internal.NewGithubActionInterface(), &internal.OSWrapper{}, []string{"snapshot", out})
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	var snapshot models.Snapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	if assert.Len(t, snapshot.Charts, 1) {
+		assert.Equal(t, "app", snapshot.Charts[0].Chart)
+		assert.Equal(t, []models.ChartVersion{{Version: "1.1.0"}, {Version: "1.0.0"}}, snapshot.Charts[0].Versions)
+	}
+}
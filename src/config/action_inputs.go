@@ -1,16 +1,26 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ironashram/argocd-apps-action/internal"
 	"github.com/ironashram/argocd-apps-action/models"
 )
 
-func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
+func NewFromInputs(action internal.ActionInterface, osi internal.OSInterface) (*models.Config, error) {
+	return newFromInputs(action, osi, false)
+}
+
+func NewSnapshotFromInputs(action internal.ActionInterface, osi internal.OSInterface) (*models.Config, error) {
+	return newFromInputs(action, osi, true)
+}
+
+func newFromInputs(action internal.ActionInterface, osi internal.OSInterface, snapshot bool) (*models.Config, error) {
 	skipPreReleaseStr := action.GetInput("skip_prerelease")
 	targetBranch := action.GetInput("target_branch")
 	createPrStr := action.GetInput("create_pr")
@@ -23,7 +33,12 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 	labelsStr := action.GetInput("labels")
 	fileExtStr := action.GetInput("file_extensions")
 	allowRegexFallbackStr := action.GetInput("allow_regex_fallback")
+	valuesTemplatesStr := action.GetInput("values_templates")
 
+	if snapshot {
+		createPrStr = cmp.Or(strings.TrimSpace(createPrStr), "false")
+		skipPreReleaseStr = cmp.Or(strings.TrimSpace(skipPreReleaseStr), "false")
+	}
 	createPr, err := strconv.ParseBool(createPrStr)
 	if err != nil {
 		return nil, fmt.Errorf("create_pr input is invalid: %w", err)
@@ -42,6 +57,14 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 		}
 	}
 
+	valuesTemplates := false
+	if strings.TrimSpace(valuesTemplatesStr) != "" {
+		valuesTemplates, err = strconv.ParseBool(valuesTemplatesStr)
+		if err != nil {
+			return nil, fmt.Errorf("values_templates input is invalid: %w", err)
+		}
+	}
+
 	labels := strings.Split(labelsStr, ",")
 	for i, label := range labels {
 		labels[i] = strings.TrimSpace(label)
@@ -79,6 +102,39 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 		preset = "argocd"
 	}
 	sourcesFile := strings.TrimSpace(action.GetInput("sources_file"))
+	cacheDir := strings.TrimSpace(action.GetInput("cache_dir"))
+	maxIndexMB := 0
+	if v := strings.TrimSpace(action.GetInput("max_index_size")); v != "" {
+		maxIndexMB, err = strconv.Atoi(v)
+		if err != nil || maxIndexMB <= 0 {
+			return nil, fmt.Errorf("max_index_size input is invalid, expected a positive number of MiB: %q", v)
+		}
+	}
+
+	concurrency := 0
+	if v := strings.TrimSpace(action.GetInput("concurrency")); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil || concurrency <= 0 {
+			return nil, fmt.Errorf("concurrency input is invalid, expected a positive number: %q", v)
+		}
+	}
+
+	httpRetries := 3
+	if v := strings.TrimSpace(action.GetInput("http_retries")); v != "" {
+		httpRetries, err = strconv.Atoi(v)
+		if err != nil || httpRetries < 0 {
+			return nil, fmt.Errorf("http_retries input is invalid, expected a number >= 0: %q", v)
+		}
+	}
+
+	httpTimeout := 30 * time.Second
+	if v := strings.TrimSpace(action.GetInput("http_timeout")); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs <= 0 {
+			return nil, fmt.Errorf("http_timeout input is invalid, expected a positive number of seconds: %q", v)
+		}
+		httpTimeout = time.Duration(secs) * time.Second
+	}
 
 	var repoCreds []models.RepoCredential
 	for _, line := range strings.Split(action.GetInput("repo_credentials"), "\n") {
@@ -86,24 +142,66 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 		if line == "" {
 			continue
 		}
-		parts := strings.SplitN(line, "|", 3)
-		if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
-			return nil, fmt.Errorf("repo_credentials line is invalid, expected url-prefix|username|password: %q", line)
+		cred, err := parseRepoCredential(line)
+		if err != nil {
+			return nil, err
+		}
+		if err := resolveCredentialSecrets(action, osi, &cred); err != nil {
+			return nil, err
+		}
+		repoCreds = append(repoCreds, cred)
+	}
+
+	var repoTLS []models.RepoTLS
+	for _, line := range strings.Split(action.GetInput("repo_tls"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		t, err := parseRepoTLS(line)
+		if err != nil {
+			return nil, err
+		}
+		repoTLS = append(repoTLS, t)
+	}
+
+	var signaturePolicies []models.SignaturePolicy
+	for _, line := range strings.Split(action.GetInput("signature_policy"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sp, err := parseSignaturePolicy(line)
+		if err != nil {
+			return nil, err
 		}
-		repoCreds = append(repoCreds, models.RepoCredential{
-			URLPrefix: strings.TrimSpace(parts[0]),
-			Username:  strings.TrimSpace(parts[1]),
-			Password:  strings.TrimSpace(parts[2]),
-		})
+		signaturePolicies = append(signaturePolicies, sp)
 	}
 
-	parts := strings.Split(repo, "/")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid GITHUB_REPOSITORY: %s", repo)
+	versionsSnapshot := strings.TrimSpace(action.GetInput("versions_snapshot"))
+
+	var repoSources []models.RepoSource
+	for _, line := range strings.Split(action.GetInput("repo_sources"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		prefix, source, ok := strings.Cut(line, "|")
+		prefix, source = strings.TrimSpace(prefix), strings.ToLower(strings.TrimSpace(source))
+		if !ok || prefix == "" || source == "" {
+			return nil, fmt.Errorf("repo_sources line is invalid, expected url-prefix|source: %q", line)
+		}
+		repoSources = append(repoSources, models.RepoSource{URLPrefix: prefix, Source: source})
 	}
 
-	owner := parts[0]
-	name := parts[1]
+	var owner, name string
+	if !snapshot || repo != "" {
+		parts := strings.Split(repo, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid GITHUB_REPOSITORY: %s", repo)
+		}
+		owner, name = parts[0], parts[1]
+	}
 
 	action.Debugf("skip_prerelease: %v", skipPreRelease)
 	action.Debugf("target_branch: %s", targetBranch)
@@ -111,11 +209,21 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 	action.Debugf("apps_folder: %s", appsFolder)
 	action.Debugf("file_extensions: %v", fileExtensions)
 	action.Debugf("allow_regex_fallback: %v", allowRegexFallback)
+	action.Debugf("values_templates: %v", valuesTemplates)
 	action.Debugf("api_url: %s", apiURL)
 	action.Debugf("provider: %s", provider)
 	action.Debugf("preset: %s", preset)
 	action.Debugf("sources_file: %s", sourcesFile)
+	action.Debugf("cache_dir: %s", cacheDir)
+	action.Debugf("max_index_size: %d", maxIndexMB)
+	action.Debugf("concurrency: %d", concurrency)
+	action.Debugf("http_retries: %d", httpRetries)
+	action.Debugf("http_timeout: %s", httpTimeout)
 	action.Debugf("repo_credentials: %d configured", len(repoCreds))
+	action.Debugf("repo_tls: %d configured", len(repoTLS))
+	action.Debugf("signature_policy: %d configured", len(signaturePolicies))
+	action.Debugf("repo_sources: %d configured", len(repoSources))
+	action.Debugf("versions_snapshot: %s", versionsSnapshot)
 
 	c := models.Config{
 		SkipPreRelease:     skipPreRelease,
@@ -130,11 +238,160 @@ func NewFromInputs(action internal.ActionInterface) (*models.Config, error) {
 		Labels:             labels,
 		FileExtensions:     fileExtensions,
 		AllowRegexFallback: allowRegexFallback,
+		ValuesTemplates:    valuesTemplates,
 		ApiURL:             apiURL,
 		Provider:           provider,
 		Preset:             preset,
 		SourcesFile:        sourcesFile,
+		CacheDir:           cacheDir,
+		MaxIndexMB:         maxIndexMB,
+		Concurrency:        concurrency,
+		HTTPRetries:        httpRetries,
+		HTTPTimeout:        httpTimeout,
 		RepoCreds:          repoCreds,
+		RepoTLS:            repoTLS,
+		SignaturePolicies:  signaturePolicies,
+		RepoSources:        repoSources,
+		VersionsSnapshot:   versionsSnapshot,
 	}
 	return &c, nil
 }
+
+func parseRepoCredential(line string) (models.RepoCredential, error) {
+	kind, rest, _ := strings.Cut(line, "|")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+
+	var cred models.RepoCredential
+	var parts []string
+	switch kind {
+	case models.CredentialBasic, models.CredentialHeader:
+		parts = strings.SplitN(rest, "|", 3)
+	case models.CredentialBearer:
+		parts = strings.SplitN(rest, "|", 2)
+	default:
+		kind = ""
+		parts = strings.SplitN(line, "|", 3)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	switch {
+	case kind == models.CredentialBearer && len(parts) == 2 && parts[0] != "":
+		cred = models.RepoCredential{URLPrefix: parts[0], Type: kind, Token: parts[1]}
+	case kind == models.CredentialHeader && len(parts) == 3 && parts[0] != "" && parts[1] != "":
+		cred = models.RepoCredential{URLPrefix: parts[0], Type: kind, HeaderName: parts[1], HeaderValue: parts[2]}
+	case kind != models.CredentialBearer && kind != models.CredentialHeader && len(parts) == 3 && parts[0] != "":
+		cred = models.RepoCredential{URLPrefix: parts[0], Type: kind, Username: parts[1], Password: parts[2]}
+	default:
+		return cred, fmt.Errorf("repo_credentials line is invalid, expected url-prefix|username|password, basic|url-prefix|username|password, bearer|url-prefix|token or header|url-prefix|name|value: %q", redactCredential(line))
+	}
+	return cred, nil
+}
+
+func parseRepoTLS(line string) (models.RepoTLS, error) {
+	fields := strings.Split(line, "|")
+	t := models.RepoTLS{URLPrefix: strings.TrimSpace(fields[0])}
+	if t.URLPrefix == "" {
+		return t, fmt.Errorf("repo_tls line is invalid, expected url-prefix|ca=path|cert=path|key=path|insecure=true: %q", line)
+	}
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return t, fmt.Errorf("repo_tls option %q for %s is invalid, expected name=value", field, t.URLPrefix)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "ca":
+			t.CAFile = value
+		case "cert":
+			t.CertFile = value
+		case "key":
+			t.KeyFile = value
+		case "insecure":
+			insecure, err := strconv.ParseBool(value)
+			if err != nil {
+				return t, fmt.Errorf("repo_tls option insecure for %s is invalid, expected true or false: %q", t.URLPrefix, value)
+			}
+			t.Insecure = insecure
+		default:
+			return t, fmt.Errorf("repo_tls option %q for %s is unknown, expected ca, cert, key or insecure", name, t.URLPrefix)
+		}
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return t, fmt.Errorf("repo_tls for %s must set both cert and key", t.URLPrefix)
+	}
+	return t, nil
+}
+
+func parseSignaturePolicy(line string) (models.SignaturePolicy, error) {
+	fields := strings.Split(line, "|")
+	sp := models.SignaturePolicy{URLPrefix: strings.TrimSpace(fields[0])}
+	if sp.URLPrefix == "" || len(fields) < 2 {
+		return sp, fmt.Errorf("signature_policy line is invalid, expected url-prefix|off, warn or require|keyring=path|cosign-key=path|notation-cert=path: %q", line)
+	}
+	sp.Policy = strings.ToLower(strings.TrimSpace(fields[1]))
+	switch sp.Policy {
+	case models.SignatureOff, models.SignatureWarn, models.SignatureRequire:
+	default:
+		return sp, fmt.Errorf("signature_policy for %s is invalid, expected off, warn or require: %q", sp.URLPrefix, fields[1])
+	}
+	for _, field := range fields[2:] {
+		name, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return sp, fmt.Errorf("signature_policy option %q for %s is invalid, expected name=value", field, sp.URLPrefix)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "keyring":
+			sp.Keyring = value
+		case "cosign-key":
+			sp.CosignKey = value
+		case "notation-cert":
+			sp.NotationCert = value
+		default:
+			return sp, fmt.Errorf("signature_policy option %q for %s is unknown, expected keyring, cosign-key or notation-cert", name, sp.URLPrefix)
+		}
+	}
+	if sp.Policy != models.SignatureOff && sp.Keyring == "" && sp.CosignKey == "" && sp.NotationCert == "" {
+		return sp, fmt.Errorf("signature_policy for %s needs a keyring, cosign-key or notation-cert", sp.URLPrefix)
+	}
+	return sp, nil
+}
+
+func resolveCredentialSecrets(action internal.ActionInterface, osi internal.OSInterface, cred *models.RepoCredential) error {
+	for _, field := range []*string{&cred.Username, &cred.Password, &cred.Token, &cred.HeaderValue} {
+		switch {
+		case strings.HasPrefix(*field, "raw:"):
+			*field = strings.TrimPrefix(*field, "raw:")
+		case strings.HasPrefix(*field, "env:"):
+			name := strings.TrimPrefix(*field, "env:")
+			value := action.Getenv(name)
+			if value == "" {
+				return fmt.Errorf("repo_credentials for %s references environment variable %s, which is not set", cred.URLPrefix, name)
+			}
+			*field = value
+		case strings.HasPrefix(*field, "file:"):
+			path := strings.TrimPrefix(*field, "file:")
+			data, err := osi.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("repo_credentials for %s references file %s: %w", cred.URLPrefix, path, err)
+			}
+			*field = strings.TrimRight(string(data), "\r\n")
+		}
+	}
+	return nil
+}
+
+func redactCredential(line string) string {
+	fields := strings.Split(line, "|")
+	n := 1
+	switch strings.ToLower(strings.TrimSpace(fields[0])) {
+	case models.CredentialBasic, models.CredentialBearer, models.CredentialHeader:
+		n = 2
+	}
+	if len(fields) <= n {
+		return line
+	}
+	return strings.Join(fields[:n], "|") + "|***"
+}
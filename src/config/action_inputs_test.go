@@ -1,8 +1,10 @@
 package config
 
 import (
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ironashram/argocd-apps-action/internal/mocks"
 	"github.com/ironashram/argocd-apps-action/models"
@@ -50,6 +52,8 @@ func TestNewFromInputs(t *testing.T) {
 				ApiURL:         "https://api.github.com",
 				Provider:       "auto",
 				Preset:         "argocd",
+				HTTPRetries:    3,
+				HTTPTimeout:    30 * time.Second,
 			},
 			expectedErr: nil,
 		},
@@ -85,6 +89,8 @@ func TestNewFromInputs(t *testing.T) {
 				ApiURL:         "https://api.github.com",
 				Provider:       "auto",
 				Preset:         "argocd",
+				HTTPRetries:    3,
+				HTTPTimeout:    30 * time.Second,
 			},
 			expectedErr: nil,
 		},
@@ -98,12 +104,22 @@ func TestNewFromInputs(t *testing.T) {
 			tc.action.On("Debugf", "apps_folder: %s", mock.Anything).Once()
 			tc.action.On("Debugf", "file_extensions: %v", mock.Anything).Once()
 			tc.action.On("Debugf", "allow_regex_fallback: %v", mock.Anything).Once()
+			tc.action.On("Debugf", "values_templates: %v", mock.Anything).Once()
 			tc.action.On("Debugf", "api_url: %s", mock.Anything).Once()
 			tc.action.On("Debugf", "provider: %s", mock.Anything).Once()
 			tc.action.On("Debugf", "preset: %s", mock.Anything).Once()
 			tc.action.On("Debugf", "sources_file: %s", mock.Anything).Once()
+			tc.action.On("Debugf", "cache_dir: %s", mock.Anything).Once()
+			tc.action.On("Debugf", "max_index_size: %d", mock.Anything).Once()
+			tc.action.On("Debugf", "concurrency: %d", mock.Anything).Once()
+			tc.action.On("Debugf", "http_retries: %d", mock.Anything).Once()
+			tc.action.On("Debugf", "http_timeout: %s", mock.Anything).Once()
 			tc.action.On("Debugf", "repo_credentials: %d configured", mock.Anything).Once()
-			config, err := NewFromInputs(tc.action)
+			tc.action.On("Debugf", "repo_tls: %d configured", mock.Anything).Once()
+			tc.action.On("Debugf", "signature_policy: %d configured", mock.Anything).Once()
+			tc.action.On("Debugf", "repo_sources: %d configured", mock.Anything).Once()
+			tc.action.On("Debugf", "versions_snapshot: %s", mock.Anything).Once()
+			config, err := NewFromInputs(tc.action, new(mocks.MockOS))
 
 			if err != tc.expectedErr {
 				t.Errorf("Expected error: %v, got: %v", tc.expectedErr, err)
@@ -146,21 +162,21 @@ func TestNewFromInputs_FileExtensions(t *testing.T) {
 	t.Run("empty string errors", func(t *testing.T) {
 		action := withExt("")
 		setupDebugExpectations(action)
-		_, err := NewFromInputs(action)
+		_, err := NewFromInputs(action, new(mocks.MockOS))
 		assert.EqualError(t, err, "file_extensions input is empty")
 	})
 
 	t.Run("only commas errors", func(t *testing.T) {
 		action := withExt(",,,")
 		setupDebugExpectations(action)
-		_, err := NewFromInputs(action)
+		_, err := NewFromInputs(action, new(mocks.MockOS))
 		assert.ErrorContains(t, err, "file_extensions input is invalid")
 	})
 
 	t.Run("dotted extensions preserved", func(t *testing.T) {
 		action := withExt(".yaml,.yml")
 		setupDebugExpectations(action)
-		cfg, err := NewFromInputs(action)
+		cfg, err := NewFromInputs(action, new(mocks.MockOS))
 		assert.NoError(t, err)
 		assert.Equal(t, []string{".yaml", ".yml"}, cfg.FileExtensions)
 	})
@@ -168,7 +184,7 @@ func TestNewFromInputs_FileExtensions(t *testing.T) {
 	t.Run("dots prepended when missing", func(t *testing.T) {
 		action := withExt("yaml, yml")
 		setupDebugExpectations(action)
-		cfg, err := NewFromInputs(action)
+		cfg, err := NewFromInputs(action, new(mocks.MockOS))
 		assert.NoError(t, err)
 		assert.Equal(t, []string{".yaml", ".yml"}, cfg.FileExtensions)
 	})
@@ -176,7 +192,213 @@ func TestNewFromInputs_FileExtensions(t *testing.T) {
 	t.Run("empty entries between commas errors", func(t *testing.T) {
 		action := withExt("yaml,,yml,")
 		setupDebugExpectations(action)
-		_, err := NewFromInputs(action)
+		_, err := NewFromInputs(action, new(mocks.MockOS))
 		assert.ErrorContains(t, err, "file_extensions input is invalid")
 	})
 }
+
+func TestNewSnapshotFromInputs(t *testing.T) {
+	action := &mocks.MockActionInterface{
+		Inputs: map[string]string{"apps_folder": "apps", "file_extensions": "yaml"},
+		Env:    map[string]string{"GITHUB_WORKSPACE": "/workspace"},
+	}
+	action.On("Debugf", mock.Anything, mock.Anything).Maybe()
+
+	cfg, err := NewSnapshotFromInputs(action, new(mocks.MockOS))
+	assert.NoError(t, err)
+	assert.Equal(t, "/workspace", cfg.Workspace)
+	assert.Equal(t, "apps", cfg.AppsFolder)
+	assert.False(t, cfg.CreatePr)
+	assert.Empty(t, cfg.Owner)
+
+	_, err = NewFromInputs(action, new(mocks.MockOS))
+	assert.Error(t, err)
+
+	action.Env["GITHUB_REPOSITORY"] = "not-a-repo"
+	_, err = NewSnapshotFromInputs(action, new(mocks.MockOS))
+	assert.ErrorContains(t, err, "invalid GITHUB_REPOSITORY")
+}
+
+func TestNewFromInputs_FileSecrets(t *testing.T) {
+	action := &mocks.MockActionInterface{
+		Inputs: map[string]string{
+			"apps_folder":      "apps",
+			"file_extensions":  "yaml",
+			"repo_credentials": "https://charts.local|bot|file:/run/secrets/charts",
+		},
+		Env: map[string]string{"GITHUB_WORKSPACE": "/workspace"},
+	}
+	action.On("Debugf", mock.Anything, mock.Anything).Maybe()
+	osi := new(mocks.MockOS)
+	osi.On("ReadFile", "/run/secrets/charts").Return([]byte("s3cret\n"), nil)
+
+	cfg, err := NewSnapshotFromInputs(action, osi)
+	assert.NoError(t, err)
+	if assert.Len(t, cfg.RepoCreds, 1) {
+		assert.Equal(t, "s3cret", cfg.RepoCreds[0].Password)
+	}
+	osi.AssertExpectations(t)
+}
+
+func TestParseRepoCredential(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected models.RepoCredential
+		err      string
+	}{
+		{
+			line:     "https://charts.example.com|bot|pa|ss",
+			expected: models.RepoCredential{URLPrefix: "https://charts.example.com", Username: "bot", Password: "pa|ss"},
+		},
+		{
+			line:     "BASIC | https://charts.example.com | bot | s3cret",
+			expected: models.RepoCredential{URLPrefix: "https://charts.example.com", Type: "basic", Username: "bot", Password: "s3cret"},
+		},
+		{
+			line:     "bearer|oci://registry.example.com|tok|en",
+			expected: models.RepoCredential{URLPrefix: "oci://registry.example.com", Type: "bearer", Token: "tok|en"},
+		},
+		{
+			line:     "header|https://gitlab.example.com/api/v4/projects/1/packages/helm|PRIVATE-TOKEN|glpat-x",
+			expected: models.RepoCredential{URLPrefix: "https://gitlab.example.com/api/v4/projects/1/packages/helm", Type: "header", HeaderName: "PRIVATE-TOKEN", HeaderValue: "glpat-x"},
+		},
+		{line: "https://charts.example.com|bot", err: `"https://charts.example.com|***"`},
+		{line: "bearer|https://charts.example.com", err: `"bearer|https://charts.example.com"`},
+		{line: "header|https://x||value", err: `"header|https://x|***"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			cred, err := parseRepoCredential(tc.line)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, cred)
+		})
+	}
+}
+
+func TestParseRepoTLS(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected models.RepoTLS
+		err      string
+	}{
+		{
+			line:     "https://charts.corp|ca=/etc/ssl/corp.pem",
+			expected: models.RepoTLS{URLPrefix: "https://charts.corp", CAFile: "/etc/ssl/corp.pem"},
+		},
+		{
+			line:     "harbor.corp | cert=client.pem | key=client.key | insecure=true",
+			expected: models.RepoTLS{URLPrefix: "harbor.corp", CertFile: "client.pem", KeyFile: "client.key", Insecure: true},
+		},
+		{line: "|ca=x", err: "repo_tls line is invalid"},
+		{line: "harbor.corp|ca", err: "expected name=value"},
+		{line: "harbor.corp|pin=abc", err: `repo_tls option "pin" for harbor.corp is unknown`},
+		{line: "harbor.corp|insecure=maybe", err: "expected true or false"},
+		{line: "harbor.corp|cert=client.pem", err: "must set both cert and key"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			result, err := parseRepoTLS(tc.line)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestParseSignaturePolicy(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected models.SignaturePolicy
+		err      string
+	}{
+		{
+			line:     "https://charts.example.com|require|keyring=/keys/pubring.gpg",
+			expected: models.SignaturePolicy{URLPrefix: "https://charts.example.com", Policy: "require", Keyring: "/keys/pubring.gpg"},
+		},
+		{
+			line:     "oci://ghcr.io/org | WARN | cosign-key=cosign.pub | notation-cert=root.pem",
+			expected: models.SignaturePolicy{URLPrefix: "oci://ghcr.io/org", Policy: "warn", CosignKey: "cosign.pub", NotationCert: "root.pem"},
+		},
+		{
+			line:     "ghcr.io/org/unsigned|off",
+			expected: models.SignaturePolicy{URLPrefix: "ghcr.io/org/unsigned", Policy: "off"},
+		},
+		{line: "ghcr.io/org", err: "signature_policy line is invalid"},
+		{line: "ghcr.io/org|strict|cosign-key=k", err: "expected off, warn or require"},
+		{line: "ghcr.io/org|require", err: "needs a keyring, cosign-key or notation-cert"},
+		{line: "ghcr.io/org|require|fulcio=x", err: `signature_policy option "fulcio" for ghcr.io/org is unknown`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.line, func(t *testing.T) {
+			result, err := parseSignaturePolicy(tc.line)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestResolveCredentialSecrets(t *testing.T) {
+	action := &mocks.MockActionInterface{Env: map[string]string{"REGISTRY_PASSWORD": "from-env"}}
+	osi := new(mocks.MockOS)
+	osi.On("ReadFile", "/run/secrets/token").Return([]byte("from-file\n"), nil)
+	osi.On("ReadFile", "/nonexistent").Return([]byte(nil), os.ErrNotExist)
+
+	testCases := []struct {
+		name     string
+		cred     models.RepoCredential
+		expected models.RepoCredential
+		err      string
+	}{
+		{
+			name:     "env",
+			cred:     models.RepoCredential{URLPrefix: "https://x", Username: "bot", Password: "env:REGISTRY_PASSWORD"},
+			expected: models.RepoCredential{URLPrefix: "https://x", Username: "bot", Password: "from-env"},
+		},
+		{
+			name:     "file",
+			cred:     models.RepoCredential{URLPrefix: "https://x", Type: "bearer", Token: "file:/run/secrets/token"},
+			expected: models.RepoCredential{URLPrefix: "https://x", Type: "bearer", Token: "from-file"},
+		},
+		{
+			name:     "raw",
+			cred:     models.RepoCredential{URLPrefix: "https://x", Username: "bot", Password: "raw:env:not-a-reference"},
+			expected: models.RepoCredential{URLPrefix: "https://x", Username: "bot", Password: "env:not-a-reference"},
+		},
+		{
+			name: "missing variable",
+			cred: models.RepoCredential{URLPrefix: "https://x", Username: "bot", Password: "env:MISSING"},
+			err:  "repo_credentials for https://x references environment variable MISSING, which is not set",
+		},
+		{
+			name: "missing file",
+			cred: models.RepoCredential{URLPrefix: "https://x", Type: "header", HeaderName: "X", HeaderValue: "file:/nonexistent"},
+			err:  "repo_credentials for https://x references file /nonexistent",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := resolveCredentialSecrets(action, osi, &tc.cred)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, tc.cred)
+		})
+	}
+}
@@ -19,3 +19,9 @@ func (m *MockOS) WriteFile(filename string, data []byte, perm os.FileMode) error
 	args := m.Called(filename, data, perm)
 	return args.Error(0)
 }
+
+func (m *MockOS) ReadDir(name string) ([]os.DirEntry, error) {
+	args := m.Called(name)
+	entries, _ := args.Get(0).([]os.DirEntry)
+	return entries, args.Error(1)
+}
@@ -7,6 +7,7 @@ import (
 type OSInterface interface {
 	ReadFile(path string) ([]byte, error)
 	WriteFile(filename string, data []byte, perm os.FileMode) error
+	ReadDir(name string) ([]os.DirEntry, error)
 }
 
 type OSWrapper struct{}
@@ -18,3 +19,7 @@ func (osw *OSWrapper) ReadFile(path string) ([]byte, error) {
 func (osw *OSWrapper) WriteFile(filename string, data []byte, perm os.FileMode) error {
 	return os.WriteFile(filename, data, perm)
 }
+
+func (osw *OSWrapper) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
@@ -14,20 +14,33 @@ type Application struct {
 	Spec Spec `yaml:"spec"`
 }
 
+type ChartVersion struct {
+	Version    string   `yaml:"version" json:"version"`
+	AppVersion string   `yaml:"appVersion" json:"appVersion"`
+	URLs       []string `yaml:"urls" json:"urls,omitempty"`
+	Digest     string   `yaml:"digest" json:"digest,omitempty"`
+	Tag        string   `yaml:"tag,omitempty" json:"tag,omitempty"`
+}
+
 type Index struct {
-	Entries map[string][]struct {
-		Version string `yaml:"version"`
-	} `yaml:"entries"`
+	Entries map[string][]ChartVersion `yaml:"entries" json:"entries"`
 }
 
 type ChartRef struct {
 	RepoURL string
 	Chart   string
+	Source  string
 }
 
 type AppFile struct {
-	Path           string
-	CurrentVersion string
-	VersionPath    string
-	DocIndex       int
+	Path            string
+	CurrentVersion  string
+	VersionPath     string
+	DocIndex        int
+	LinkedFields    []LinkedField
+	RawVersion      string
+	VersionPattern  string
+	VersionTemplate string
+	Dependents      []string
+	Offset          int
 }
@@ -1,9 +1,48 @@
 package models
 
+import "time"
+
+const (
+	CredentialBasic  = "basic"
+	CredentialBearer = "bearer"
+	CredentialHeader = "header"
+)
+
 type RepoCredential struct {
+	URLPrefix   string
+	Type        string
+	Username    string
+	Password    string
+	Token       string
+	HeaderName  string
+	HeaderValue string
+}
+
+type RepoTLS struct {
+	URLPrefix string
+	CAFile    string
+	CertFile  string
+	KeyFile   string
+	Insecure  bool
+}
+
+const (
+	SignatureOff     = "off"
+	SignatureWarn    = "warn"
+	SignatureRequire = "require"
+)
+
+type SignaturePolicy struct {
+	URLPrefix    string
+	Policy       string
+	Keyring      string
+	CosignKey    string
+	NotationCert string
+}
+
+type RepoSource struct {
 	URLPrefix string
-	Username  string
-	Password  string
+	Source    string
 }
 
 type Config struct {
@@ -19,9 +58,19 @@ type Config struct {
 	Labels             []string
 	FileExtensions     []string
 	AllowRegexFallback bool
+	ValuesTemplates    bool
 	ApiURL             string
 	Provider           string
 	Preset             string
 	SourcesFile        string
+	CacheDir           string
+	MaxIndexMB         int
+	Concurrency        int
+	HTTPRetries        int
+	HTTPTimeout        time.Duration
 	RepoCreds          []RepoCredential
+	RepoTLS            []RepoTLS
+	SignaturePolicies  []SignaturePolicy
+	RepoSources        []RepoSource
+	VersionsSnapshot   string
 }
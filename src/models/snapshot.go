@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Snapshot struct {
+	Generated time.Time       `yaml:"generated" json:"generated"`
+	Charts    []SnapshotChart `yaml:"charts" json:"charts"`
+}
+
+type SnapshotChart struct {
+	RepoURL  string         `yaml:"repoURL" json:"repoURL"`
+	Chart    string         `yaml:"chart" json:"chart"`
+	Versions []ChartVersion `yaml:"versions" json:"versions"`
+}
@@ -13,13 +13,23 @@ type RepoRule struct {
 	SkipIfSet     string   `yaml:"skipIfSet"`
 }
 
+type LinkedField struct {
+	Path     string `yaml:"path"`
+	Template string `yaml:"template"`
+}
+
 type ChartRule struct {
-	Files         []string `yaml:"files"`
-	ChartPath     string   `yaml:"chartPath"`
-	VersionPath   string   `yaml:"versionPath"`
-	URLPath       string   `yaml:"urlPath"`
-	RepoRef       *RepoRef `yaml:"repoRef"`
-	RegexFallback bool     `yaml:"regexFallback"`
+	Files           []string      `yaml:"files"`
+	ChartPath       string        `yaml:"chartPath"`
+	VersionPath     string        `yaml:"versionPath"`
+	URLPath         string        `yaml:"urlPath"`
+	RepoRef         *RepoRef      `yaml:"repoRef"`
+	RegexFallback   bool          `yaml:"regexFallback"`
+	ValuesTemplates bool          `yaml:"valuesTemplates"`
+	LinkedFields    []LinkedField `yaml:"linkedFields"`
+	VersionPattern  string        `yaml:"versionPattern"`
+	VersionTemplate string        `yaml:"versionTemplate"`
+	Source          string        `yaml:"source"`
 }
 
 type SourcesConfig struct {
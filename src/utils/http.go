@@ -2,15 +2,104 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"time"
 )
 
-var httpClient = &http.Client{Timeout: 30 * time.Second}
+const defaultTimeout = 30 * time.Second
+
+type requestOptions struct {
+	cacheDir string
+	maxBytes int64
+	retries  int
+	timeout  time.Duration
+	header   http.Header
+	base     http.RoundTripper
+}
+
+type RequestOption func(*requestOptions)
+
+func WithCacheDir(dir string) RequestOption {
+	return func(o *requestOptions) {
+		o.cacheDir = dir
+	}
+}
+
+func WithMaxBytes(n int64) RequestOption {
+	return func(o *requestOptions) {
+		o.maxBytes = n
+	}
+}
+
+func WithRetries(n int) RequestOption {
+	return func(o *requestOptions) {
+		o.retries = n
+	}
+}
+
+func WithTimeout(d time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		if d > 0 {
+			o.timeout = d
+		}
+	}
+}
+
+func WithBearerToken(token string) RequestOption {
+	return WithHeader("Authorization", "Bearer "+token)
+}
+
+func WithHeader(name, value string) RequestOption {
+	return func(o *requestOptions) {
+		if o.header == nil {
+			o.header = http.Header{}
+		}
+		o.header.Set(name, value)
+	}
+}
+
+func WithTransport(rt http.RoundTripper) RequestOption {
+	return func(o *requestOptions) {
+		o.base = rt
+	}
+}
+
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("HTTP request failed with status code %d", e.StatusCode)
+}
+
+type cacheMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+func GetHTTPResponse(ctx context.Context, url string, username string, password string, opts ...RequestOption) ([]byte, error) {
+	body, err := OpenHTTPResponse(ctx, url, username, password, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func OpenHTTPResponse(ctx context.Context, url string, username string, password string, opts ...RequestOption) (io.ReadCloser, error) {
+	o := requestOptions{timeout: defaultTimeout}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
-func GetHTTPResponse(ctx context.Context, url string, username string, password string) ([]byte, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -19,21 +108,175 @@ func GetHTTPResponse(ctx context.Context, url string, username string, password
 	if username != "" || password != "" {
 		req.SetBasicAuth(username, password)
 	}
+	for name, values := range o.header {
+		req.Header[name] = values
+	}
 
-	resp, err := httpClient.Do(req)
+	var base string
+	cached := false
+	if o.cacheDir != "" {
+		sum := sha256.Sum256([]byte(url))
+		base = filepath.Join(o.cacheDir, hex.EncodeToString(sum[:]))
+		if meta, ok := readCacheMeta(base, url); ok {
+			cached = true
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+	}
+
+	resp, err := NewHTTPClient(o.retries, o.timeout, o.base).Do(req)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached {
+		resp.Body.Close()
+		f, err := os.Open(base + ".body")
+		if err != nil {
+			return nil, err
+		}
+		return limitBody(f, o.maxBytes), nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP request failed with status code %d", resp.StatusCode)
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if o.maxBytes > 0 && resp.ContentLength > o.maxBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("response of %d bytes exceeds the limit of %d bytes", resp.ContentLength, o.maxBytes)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	body := limitBody(resp.Body, o.maxBytes)
+	if base != "" {
+		meta := cacheMeta{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if meta.ETag != "" || meta.LastModified != "" {
+			body = newCachingBody(body, base, meta)
+		}
+	}
+	return body, nil
+}
+
+type maxBytesBody struct {
+	io.ReadCloser
+	n     int64
+	limit int64
+}
+
+func limitBody(rc io.ReadCloser, n int64) io.ReadCloser {
+	if n <= 0 {
+		return rc
+	}
+	return &maxBytesBody{ReadCloser: rc, n: n, limit: n}
+}
+
+func (b *maxBytesBody) Read(p []byte) (int, error) {
+	if b.n < 0 {
+		return 0, fmt.Errorf("response exceeds the limit of %d bytes", b.limit)
+	}
+	if int64(len(p)) > b.n+1 {
+		p = p[:b.n+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= int64(n)
+	if b.n < 0 {
+		return n, fmt.Errorf("response exceeds the limit of %d bytes", b.limit)
+	}
+	return n, err
+}
+
+// Failing to write the cache is not an error.
+type cachingBody struct {
+	io.ReadCloser
+	tmp  *os.File
+	base string
+	meta cacheMeta
+	eof  bool
+}
+
+func newCachingBody(rc io.ReadCloser, base string, meta cacheMeta) io.ReadCloser {
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+		return rc
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(base), filepath.Base(base)+".*")
 	if err != nil {
-		return nil, err
+		return rc
 	}
+	return &cachingBody{ReadCloser: rc, tmp: tmp, base: base, meta: meta}
+}
 
-	return body, nil
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.tmp != nil {
+		if _, werr := b.tmp.Write(p[:n]); werr != nil {
+			b.discard()
+		}
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.tmp == nil {
+		return err
+	}
+	if !b.eof {
+		b.discard()
+		return err
+	}
+	name := b.tmp.Name()
+	if b.tmp.Close() == nil {
+		_ = commitCache(b.base, name, b.meta)
+	}
+	os.Remove(name)
+	return err
+}
+
+func (b *cachingBody) discard() {
+	b.tmp.Close()
+	os.Remove(b.tmp.Name())
+	b.tmp = nil
+}
+
+func readCacheMeta(base, url string) (cacheMeta, bool) {
+	var meta cacheMeta
+	data, err := os.ReadFile(base + ".json")
+	if err != nil || json.Unmarshal(data, &meta) != nil || meta.URL != url {
+		return meta, false
+	}
+	if _, err := os.Stat(base + ".body"); err != nil {
+		return meta, false
+	}
+	return meta, true
+}
+
+// The body is moved first so that validators never describe another body.
+func commitCache(base, body string, meta cacheMeta) error {
+	os.Remove(base + ".json")
+	if err := os.Rename(body, base+".body"); err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(base), filepath.Base(base)+".*")
+	if err != nil {
+		return err
+	}
+	_, werr := tmp.Write(data)
+	if cerr := tmp.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr != nil {
+		os.Remove(tmp.Name())
+		return werr
+	}
+	return os.Rename(tmp.Name(), base+".json")
 }
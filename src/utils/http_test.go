@@ -2,9 +2,11 @@ package utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -56,6 +58,10 @@ func TestGetHTTPResponse(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			result, err := GetHTTPResponse(context.Background(), tc.url, "", "")
+			var statusErr *StatusError
+			if tc.err != nil && !errors.As(err, &statusErr) {
+				t.Errorf("Expected a StatusError, got: %v", err)
+			}
 			if err != nil {
 				if tc.err == nil || err.Error() != tc.err.Error() {
 					t.Errorf("Expected error: %v, got: %v", tc.err, err)
@@ -93,3 +99,59 @@ func TestGetHTTPResponse_BasicAuth(t *testing.T) {
 		t.Error("Expected 401 error without credentials")
 	}
 }
+
+func TestGetHTTPResponse_CacheDir(t *testing.T) {
+	downloads := 0
+	body := "v1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + body + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads++
+		w.Header().Set("ETag", etag)
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	get := func() string {
+		result, err := GetHTTPResponse(context.Background(), server.URL+"/index.yaml", "", "", WithCacheDir(dir))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		return string(result)
+	}
+
+	if got := get(); got != "v1" || downloads != 1 {
+		t.Fatalf("Expected v1 after 1 download, got %s after %d", got, downloads)
+	}
+	if got := get(); got != "v1" || downloads != 1 {
+		t.Errorf("Expected cached v1 without download, got %s after %d", got, downloads)
+	}
+	body = "v2"
+	if got := get(); got != "v2" || downloads != 2 {
+		t.Errorf("Expected v2 after 2 downloads, got %s after %d", got, downloads)
+	}
+}
+
+func TestGetHTTPResponse_MaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		fmt.Fprint(w, "0123456789")
+	}))
+	defer server.Close()
+
+	for _, p := range []string{"/sized", "/chunked"} {
+		if _, err := GetHTTPResponse(context.Background(), server.URL+p, "", "", WithMaxBytes(10)); err != nil {
+			t.Errorf("%s: expected no error at the limit, got: %v", p, err)
+		}
+		_, err := GetHTTPResponse(context.Background(), server.URL+p, "", "", WithMaxBytes(9))
+		if err == nil || !strings.Contains(err.Error(), "exceeds the limit of 9 bytes") {
+			t.Errorf("%s: expected size limit error, got: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+var (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+	// A server asking for a longer wait is not retried.
+	maxRetryAfter = 2 * time.Minute
+)
+
+func NewHTTPClient(retries int, timeout time.Duration, base http.RoundTripper) *http.Client {
+	policy := RetryPolicy{MaxRetries: retries}
+	return &http.Client{
+		Transport: &retry.Transport{
+			Base:   &attemptTimeout{base: base, timeout: timeout},
+			Policy: func() retry.Policy { return policy },
+		},
+	}
+}
+
+type RetryPolicy struct {
+	MaxRetries int
+}
+
+func (p RetryPolicy) Retry(attempt int, resp *http.Response, err error) (time.Duration, error) {
+	if attempt >= p.MaxRetries {
+		return -1, nil
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return -1, nil
+		}
+		return backoff(attempt), nil
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return -1, nil
+	}
+	if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		if d > maxRetryAfter {
+			return -1, nil
+		}
+		return d, nil
+	}
+	return backoff(attempt), nil
+}
+
+func backoff(attempt int) time.Duration {
+	d := retryBaseDelay << min(attempt, 16)
+	if d <= 0 || d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func retryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+type attemptTimeout struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *attemptTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.timeout <= 0 {
+		return base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
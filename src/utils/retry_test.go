@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetHTTPResponse_Retries(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch attempts.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, "slow")
+		default:
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer server.Close()
+
+	result, err := GetHTTPResponse(context.Background(), server.URL, "", "", WithRetries(3), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if string(result) != "ok" || attempts.Load() != 4 {
+		t.Errorf("Expected ok after 4 attempts, got %s after %d", result, attempts.Load())
+	}
+
+	attempts.Store(0)
+	_, err = GetHTTPResponse(context.Background(), server.URL, "", "", WithRetries(1))
+	if err == nil || err.Error() != "HTTP request failed with status code 429" {
+		t.Errorf("Expected 429 once retries are exhausted, got: %v", err)
+	}
+}
+
+func TestGetHTTPResponse_NoRetry(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		header string
+	}{
+		{name: "client error", status: http.StatusNotFound},
+		{name: "retry-after too long", status: http.StatusServiceUnavailable, header: "3600"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				if tc.header != "" {
+					w.Header().Set("Retry-After", tc.header)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer server.Close()
+
+			_, err := GetHTTPResponse(context.Background(), server.URL, "", "", WithRetries(3))
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprint(tc.status)) || attempts.Load() != 1 {
+				t.Errorf("Expected a single failed attempt, got %v after %d", err, attempts.Load())
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "7", expected: 7 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 12:00:30 GMT", expected: 30 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 11:00:00 GMT", expected: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+
+	for _, tc := range testCases {
+		d, ok := retryAfter(tc.value, now)
+		if d != tc.expected || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; expected %v, %v", tc.value, d, ok, tc.expected, tc.ok)
+		}
+	}
+}